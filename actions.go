@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sharat87/gass/report"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Set when running in a GitHub Actions workflow, to write a job summary, annotations, and masks for secret values.
+var actionsOutput *ActionsOutput
+
+// A place in a config file, to point annotations at. `Line` is zero if not known.
+type ConfigLocation struct {
+	File string
+	Line int
+}
+
+// Output for GitHub Actions, using workflow commands. See
+// <https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions>. A nil `*ActionsOutput`
+// does nothing, and is used when not running in GitHub Actions.
+type ActionsOutput struct {
+	Out             io.Writer // where workflow commands are written.
+	SummaryFile     string    // from `$GITHUB_STEP_SUMMARY`, empty if not available.
+	ForceDeleteUsed bool
+
+	// Locations of repos, envs and orgs, keyed like the state file, as in `stateKeyForRepo`.
+	locations map[string]ConfigLocation
+	// Lines of everything in each config file, keyed by file name, and then like `locations`, plus `selector:<index>`.
+	linesByFile map[string]map[string]int
+	summary     *report.MarkdownReporter
+	isFlushed   bool
+}
+
+func newActionsOutput(out io.Writer, forceDeleteUsed bool) *ActionsOutput {
+	if os.Getenv("GITHUB_ACTIONS") != "true" {
+		return nil
+	}
+
+	return &ActionsOutput{
+		Out:             out,
+		SummaryFile:     os.Getenv("GITHUB_STEP_SUMMARY"),
+		ForceDeleteUsed: forceDeleteUsed,
+		locations:       map[string]ConfigLocation{},
+		linesByFile:     map[string]map[string]int{},
+		summary:         &report.MarkdownReporter{},
+	}
+}
+
+// Mask a secret value in the workflow's logs, before it has any chance of being printed. Multi-line values are masked
+// line by line, since that's how they'd show up in logs.
+func (output *ActionsOutput) Mask(value string) {
+	if output == nil {
+		return
+	}
+
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fmt.Fprintln(output.Out, "::add-mask::"+escapeCommandData(line))
+	}
+}
+
+// Record where the repos, envs, orgs and repo selectors are in a config file, if it's YAML or JSON.
+func (output *ActionsOutput) AddConfig(file string, content []byte) {
+	if output == nil || file == "-" {
+		return
+	}
+
+	lines := locateTargets(content)
+	output.linesByFile[file] = lines
+
+	for key, line := range lines {
+		if !strings.HasPrefix(key, "selector:") {
+			output.locations[key] = ConfigLocation{File: file, Line: line}
+		}
+	}
+}
+
+// Point a repo matched by a selector at that selector, unless the repo is also given explicitly.
+func (output *ActionsOutput) AddSelectorMatch(file string, selectorIndex int, fullRepoName string) {
+	if output == nil || file == "-" {
+		return
+	}
+
+	key := stateKeyForRepo(fullRepoName)
+	if _, ok := output.locations[key]; !ok {
+		output.locations[key] = ConfigLocation{File: file, Line: output.linesByFile[file]["selector:"+strconv.Itoa(selectorIndex)]}
+	}
+}
+
+// Annotate secrets that are used but missing, and secrets that are used but set for deletion.
+func (output *ActionsOutput) AddPlan(plan report.Plan) {
+	if output == nil {
+		return
+	}
+
+	output.summary.Plan(plan)
+
+	for _, target := range plan.Targets {
+		for _, secret := range target.Secrets {
+			if secret.Action == "missing" {
+				output.annotate("warning", target, "Secret "+secret.Name+" is used in "+strings.Join(secret.UsedIn, ", ")+", but isn't specified")
+			} else if secret.Action == "delete" && len(secret.UsedIn) > 0 {
+				level := "error"
+				if output.ForceDeleteUsed {
+					level = "warning"
+				}
+				output.annotate(level, target, "Secret "+secret.Name+" is set for deletion, but is used in "+strings.Join(secret.UsedIn, ", "))
+			}
+		}
+	}
+}
+
+func (output *ActionsOutput) AddResults(results []report.Result) {
+	if output == nil {
+		return
+	}
+
+	output.summary.Results(results)
+}
+
+// Write the job summary, if there's a plan. Safe to call more than once, only the first call writes anything.
+func (output *ActionsOutput) Flush() {
+	if output == nil || output.isFlushed || output.SummaryFile == "" {
+		return
+	}
+	output.isFlushed = true
+
+	file, err := os.OpenFile(output.SummaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing job summary:", err)
+		return
+	}
+	defer file.Close()
+
+	output.summary.Out = file
+	output.summary.Flush()
+}
+
+func (output *ActionsOutput) annotate(level string, target report.Target, message string) {
+	title := target.Name
+	key := stateKeyForRepo(target.Name)
+	if target.Type == "org" {
+		title = "org " + target.Name
+		key = stateKeyForOrg(target.Name)
+	}
+
+	// Env secrets point at the env if it's located, or else at its repo.
+	location := output.locations[key]
+	if target.Env != "" {
+		title += " env " + target.Env
+		if envLocation, ok := output.locations[stateKeyForEnv(target.Name, target.Env)]; ok {
+			location = envLocation
+		}
+	}
+
+	properties := []string{"title=" + escapeCommandProperty("gass: "+title)}
+	if location.File != "" {
+		properties = append(properties, "file="+escapeCommandProperty(location.File))
+		if location.Line > 0 {
+			properties = append(properties, "line="+strconv.Itoa(location.Line))
+		}
+	}
+
+	fmt.Fprintln(output.Out, "::"+level+" "+strings.Join(properties, ",")+"::"+escapeCommandData(message))
+}
+
+func escapeCommandData(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+func escapeCommandProperty(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(value)
+}
+
+// Find the lines of repos, envs, orgs and repo selectors in a config file, keyed like `ActionsOutput.linesByFile`. Only
+// works for YAML, and JSON, since that's valid YAML too. Returns an empty map for anything else.
+func locateTargets(content []byte) map[string]int {
+	lines := map[string]int{}
+
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(content, &document); err != nil || len(document.Content) == 0 {
+		return lines
+	}
+
+	root := document.Content[0]
+
+	for _, repo := range mappingPairs(mappingValue(root, "repos")) {
+		lines[stateKeyForRepo(repo[0].Value)] = repo[0].Line
+		for _, env := range mappingPairs(mappingValue(repo[1], "envs")) {
+			lines[stateKeyForEnv(repo[0].Value, env[0].Value)] = env[0].Line
+		}
+	}
+
+	for _, org := range mappingPairs(mappingValue(root, "orgs")) {
+		lines[stateKeyForOrg(org[0].Value)] = org[0].Line
+	}
+
+	if selectors := mappingValue(root, "repo_selectors"); selectors != nil && selectors.Kind == yaml.SequenceNode {
+		for i, selector := range selectors.Content {
+			lines["selector:"+strconv.Itoa(i)] = selector.Line
+		}
+	}
+
+	return lines
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for _, pair := range mappingPairs(node) {
+		if pair[0].Value == key {
+			return pair[1]
+		}
+	}
+	return nil
+}
+
+// Key and value node pairs of a mapping node. Empty if the node isn't a mapping.
+func mappingPairs(node *yaml.Node) [][2]*yaml.Node {
+	pairs := [][2]*yaml.Node{}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return pairs
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+	}
+	return pairs
+}
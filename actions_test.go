@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"github.com/sharat87/gass/github"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const actionsTestConfig = `
+repos:
+  sharat87/prestige:
+    secrets:
+      ONE: one
+    envs:
+      production:
+        secrets:
+          TWO: two
+
+repo_selectors:
+  - org: acme
+    secrets:
+      THREE: three
+
+orgs:
+  acme:
+    secrets:
+      FOUR: four
+`
+
+func TestLocateTargets(t *testing.T) {
+	assert.Equal(t, map[string]int{
+		"repo:sharat87/prestige":                3,
+		"repo:sharat87/prestige:env:production": 7,
+		"selector:0":                            12,
+		"org:acme":                              17,
+	}, locateTargets([]byte(actionsTestConfig)))
+
+	assert.Equal(t, map[string]int{"org:acme": 1}, locateTargets([]byte(`{"orgs": {"acme": {}}}`)))
+	assert.Empty(t, locateTargets([]byte("[orgs.acme]\nsecrets = {}")))
+}
+
+func TestActionsMask(t *testing.T) {
+	out := &bytes.Buffer{}
+	output := &ActionsOutput{Out: out}
+
+	output.Mask("first line\r\n\nsecond 100%\n")
+	assert.Equal(t, "::add-mask::first line\n::add-mask::second 100%25\n", out.String())
+}
+
+func TestActionsAnnotations(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+
+	out := &bytes.Buffer{}
+	output := newActionsOutput(out, false)
+	output.AddConfig("secrets.yml", []byte(actionsTestConfig))
+	output.AddSelectorMatch("secrets.yml", 0, "acme/api")
+	output.AddSelectorMatch("secrets.yml", 0, "sharat87/prestige")
+
+	output.AddPlan(buildPlan([]QualifiedSecretCallsByRepo{
+		{
+			FullRepoName: "sharat87/prestige",
+			UsedSecrets:  map[string][]github.SecretUsage{"MISSING": {{File: "build.yml", Job: "build", Line: 7}}},
+		},
+		{
+			FullRepoName: "acme/api",
+			Calls:        []QualifiedSecretCall{{Call: "delete", SecretName: "OLD"}},
+			UsedSecrets:  map[string][]github.SecretUsage{"OLD": {{File: "deploy.yml", Line: 4}}},
+		},
+	}, nil))
+
+	assert.Equal(t, []string{
+		"::warning title=gass%3A sharat87/prestige,file=secrets.yml,line=3::Secret MISSING is used in build.yml:7 (job build), but isn't specified",
+		"::error title=gass%3A acme/api,file=secrets.yml,line=12::Secret OLD is set for deletion, but is used in deploy.yml:4",
+	}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+}
+
+func TestActionsOutputOutsideActions(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "")
+	assert.Nil(t, newActionsOutput(&bytes.Buffer{}, false))
+}
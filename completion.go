@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/sharat87/gass/parseargs"
+	"strings"
+)
+
+// Values to complete for the filter flags, read from the config files given so far. Nothing is fetched from GitHub, so
+// completion stays fast, and config files that fail to load are skipped.
+func completionValues(flagName string, ia parseargs.InvokeArgs) []string {
+	values := []string{}
+
+	for _, file := range ia.Files {
+		// Reading stdin would block the shell.
+		if file == "-" {
+			continue
+		}
+
+		spec, _, err := loadConfig(file, ia.Format)
+		if err != nil {
+			continue
+		}
+
+		switch flagName {
+		case "repo":
+			values = append(values, sortedKeys(spec.Repos)...)
+
+		case "org":
+			values = append(values, sortedKeys(spec.Orgs)...)
+			for repoName := range spec.Repos {
+				if owner, _, ok := strings.Cut(repoName, "/"); ok {
+					values = append(values, owner)
+				}
+			}
+			for _, selector := range spec.RepoSelectors {
+				values = append(values, selector.Org)
+			}
+
+		case "env":
+			for _, repo := range spec.Repos {
+				values = append(values, sortedKeys(repo.Envs)...)
+			}
+			for _, selector := range spec.RepoSelectors {
+				values = append(values, sortedKeys(selector.Envs)...)
+			}
+
+		case "secret":
+			for _, pack := range spec.Packs {
+				values = append(values, sortedKeys(pack.Secrets)...)
+			}
+			for _, repo := range spec.Repos {
+				values = append(values, repoSecretNames(repo)...)
+			}
+			for _, selector := range spec.RepoSelectors {
+				values = append(values, repoSecretNames(selector.SyncSpecRepo)...)
+			}
+			for _, org := range spec.Orgs {
+				values = append(values, sortedKeys(org.Secrets)...)
+			}
+		}
+	}
+
+	return values
+}
+
+func repoSecretNames(repo SyncSpecRepo) []string {
+	names := sortedKeys(repo.Secrets)
+	for _, env := range repo.Envs {
+		names = append(names, sortedKeys(env.Secrets)...)
+	}
+	return names
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/sharat87/gass/parseargs"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompletionValues(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secrets.yml")
+	assert.NoError(t, os.WriteFile(file, []byte(`
+packs:
+  aws:
+    secrets:
+      AWS_KEY:
+        value: key
+repos:
+  sharat87/prestige:
+    secrets:
+      ONE:
+        value: one
+    envs:
+      production:
+        secrets:
+          TWO:
+            value: two
+repo_selectors:
+  - org: acme-services
+    envs:
+      staging:
+        secrets:
+          THREE:
+            value: three
+orgs:
+  acme:
+    secrets:
+      FOUR:
+        value: four
+`), 0600))
+
+	ia := parseargs.InvokeArgs{Files: []string{file, "missing.yml", "-"}}
+	assert.ElementsMatch(t, []string{"sharat87/prestige"}, completionValues("repo", ia))
+	assert.ElementsMatch(t, []string{"acme", "sharat87", "acme-services"}, completionValues("org", ia))
+	assert.ElementsMatch(t, []string{"production", "staging"}, completionValues("env", ia))
+	assert.ElementsMatch(t, []string{"AWS_KEY", "ONE", "TWO", "THREE", "FOUR"}, completionValues("secret", ia))
+}
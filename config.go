@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Allow a secret's value to be given directly as a string, instead of as a map with a `value` key.
+func (sv *SecretValueSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		*sv = SecretValueSpec{Value: value}
+		return nil
+	}
+
+	// A separate type, without this method, so we don't recurse into this function.
+	type plainSpec SecretValueSpec
+	return unmarshal((*plainSpec)(sv))
+}
+
+// Load a config file, in the given format. If format is empty, it's guessed from the file's extension, defaulting to
+// YAML. A filename of `-` reads from stdin. The content is returned as well, so it can be looked into again, since stdin
+// can't be read twice.
+func loadConfig(filename, format string) (SyncSpec, []byte, error) {
+	var content []byte
+	var err error
+	if filename == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return SyncSpec{}, nil, err
+	}
+
+	if format == "" {
+		format = formatFromFilename(filename)
+	}
+
+	spec, err := parseConfig(content, format)
+	if err != nil {
+		return spec, content, err
+	}
+
+	// Paths in the config are relative to it, so it works the same from any directory.
+	if filename != "-" {
+		for name, repo := range spec.Repos {
+			if repo.LocalPath != "" && !filepath.IsAbs(repo.LocalPath) {
+				repo.LocalPath = filepath.Join(filepath.Dir(filename), repo.LocalPath)
+				spec.Repos[name] = repo
+			}
+		}
+	}
+
+	return spec, content, nil
+}
+
+func formatFromFilename(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return "json"
+	case ".toml":
+		return "toml"
+	default:
+		return "yaml"
+	}
+}
+
+func parseConfig(content []byte, format string) (SyncSpec, error) {
+	data := SyncSpec{}
+
+	// JSON and TOML configs are converted to YAML, so the field names and strictness are the same for all formats.
+	var raw interface{}
+	switch format {
+	case "yaml", "yml":
+
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		if err := decoder.Decode(&raw); err != nil {
+			return data, err
+		}
+
+	case "toml":
+		if _, err := toml.Decode(string(content), &raw); err != nil {
+			return data, err
+		}
+
+	default:
+		return data, fmt.Errorf("Unknown config format '%v', should be one of yaml, json or toml", format)
+	}
+
+	if raw != nil {
+		var err error
+		content, err = yaml.Marshal(raw)
+		if err != nil {
+			return data, err
+		}
+	}
+
+	err := yaml.UnmarshalStrict(content, &data)
+	return data, err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+var expectedConfig = SyncSpec{
+	Repos: map[string]SyncSpecRepo{
+		"sharat87/prestige": {
+			Delete: boolPtr(true),
+			Secrets: map[string]SecretValueSpec{
+				"ONE": {Value: "one"},
+				"TWO": {FromEnv: "TWO_ENV"},
+			},
+		},
+	},
+}
+
+func TestParseYamlConfig(t *testing.T) {
+	spec, err := parseConfig([]byte(`
+repos:
+  sharat87/prestige:
+    delete_unspecified: true
+    secrets:
+      ONE: one
+      TWO:
+        from_env: TWO_ENV
+`), "yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedConfig, spec)
+}
+
+func TestParseJsonConfig(t *testing.T) {
+	spec, err := parseConfig([]byte(`{
+	"repos": {
+		"sharat87/prestige": {
+			"delete_unspecified": true,
+			"secrets": {
+				"ONE": "one",
+				"TWO": {"from_env": "TWO_ENV"}
+			}
+		}
+	}
+}`), "json")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedConfig, spec)
+}
+
+func TestParseTomlConfig(t *testing.T) {
+	spec, err := parseConfig([]byte(`
+[repos."sharat87/prestige"]
+delete_unspecified = true
+
+[repos."sharat87/prestige".secrets]
+ONE = "one"
+TWO = { from_env = "TWO_ENV" }
+`), "toml")
+	assert.NoError(t, err)
+	assert.Equal(t, expectedConfig, spec)
+}
+
+func TestParseConfigUnknownField(t *testing.T) {
+	_, err := parseConfig([]byte(`{"repos": {"a/b": {"delete": true}}}`), "json")
+	assert.Error(t, err)
+}
+
+func TestFormatFromFilename(t *testing.T) {
+	assert.Equal(t, "yaml", formatFromFilename("secrets.yml"))
+	assert.Equal(t, "json", formatFromFilename("secrets.JSON"))
+	assert.Equal(t, "toml", formatFromFilename("secrets.toml"))
+	assert.Equal(t, "yaml", formatFromFilename("-"))
+}
+
+func TestLoadConfigLocalPath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "secrets.yml")
+	assert.NoError(t, os.WriteFile(file, []byte(`
+repos:
+  sharat87/prestige:
+    local_path: ../prestige
+  sharat87/gass:
+    local_path: /src/gass
+`), 0600))
+
+	spec, _, err := loadConfig(file, "")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "..", "prestige"), spec.Repos["sharat87/prestige"].LocalPath)
+	assert.Equal(t, "/src/gass", spec.Repos["sharat87/gass"].LocalPath)
+}
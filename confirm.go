@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/sharat87/gass/report"
+	"io"
+	"os"
+	"strings"
+)
+
+// Number of deletions in a single repo or org, above which its name has to be typed to confirm, unless changed with
+// `--delete-confirm-threshold`.
+const DEFAULT_DELETE_CONFIRM_THRESHOLD = 5
+
+func countCalls(summary *report.Summary, calls []QualifiedSecretCall) (changes int, deletes int) {
+	for _, call := range calls {
+		switch call.Call {
+		case "create":
+			summary.Creates++
+		case "update":
+			summary.Updates++
+		case "delete":
+			summary.Deletes++
+			deletes++
+		default:
+			continue
+		}
+		changes++
+	}
+	return
+}
+
+// Summarize the changes, and list the repos and orgs that have more than `deleteThreshold` deletions.
+func summarizeChanges(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg, deleteThreshold int) (report.Summary, []string) {
+	summary := report.Summary{}
+	manyDeletes := []string{}
+
+	for _, repo := range allChanges {
+		changes, deletes := countCalls(&summary, repo.Calls)
+		for _, env := range repo.Envs {
+			envChanges, envDeletes := countCalls(&summary, env.Calls)
+			changes += envChanges
+			deletes += envDeletes
+		}
+		if changes > 0 {
+			summary.Repos++
+		}
+		if deletes > deleteThreshold {
+			manyDeletes = append(manyDeletes, repo.FullRepoName)
+		}
+	}
+
+	for _, org := range allChangesForOrgs {
+		changes, deletes := countCalls(&summary, org.Calls)
+		if changes > 0 {
+			summary.Orgs++
+		}
+		if deletes > deleteThreshold {
+			manyDeletes = append(manyDeletes, org.OrgName)
+		}
+	}
+
+	return summary, manyDeletes
+}
+
+// Ask for confirmation before applying. The answer has to be `yes`, and for repos and orgs with many deletions, their
+// name has to be typed out as well.
+func confirmApply(summary report.Summary, manyDeletes []string, in io.Reader, out io.Writer) bool {
+	reader := bufio.NewReader(in)
+
+	fmt.Fprintln(out, "Changes to apply: "+summary.String()+".")
+	fmt.Fprint(out, "Type `yes` to apply: ")
+	if readAnswer(reader) != "yes" {
+		return false
+	}
+
+	for _, name := range manyDeletes {
+		fmt.Fprint(out, "Many secrets will be deleted in '"+name+"'. Type its name to confirm: ")
+		if readAnswer(reader) != name {
+			return false
+		}
+	}
+
+	return true
+}
+
+func readAnswer(reader *bufio.Reader) string {
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return ""
+	}
+	return strings.TrimSpace(line)
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
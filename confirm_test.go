@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"github.com/sharat87/gass/report"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeChanges(t *testing.T) {
+	summary, manyDeletes := summarizeChanges([]QualifiedSecretCallsByRepo{
+		{
+			FullRepoName: "sharat87/prestige",
+			Calls: []QualifiedSecretCall{
+				{Call: "create", SecretName: "ONE"},
+				{Call: "unchanged", SecretName: "TWO"},
+				{Call: "delete", SecretName: "THREE"},
+			},
+			Envs: map[string]QualifiedSecretCallsByRepoEnv{
+				"production": {Calls: []QualifiedSecretCall{
+					{Call: "update", SecretName: "ONE"},
+					{Call: "delete", SecretName: "FOUR"},
+				}},
+			},
+		},
+		{
+			FullRepoName: "sharat87/httpbun",
+			Calls: []QualifiedSecretCall{
+				{Call: "unchanged", SecretName: "ONE"},
+			},
+		},
+	}, []QualifiedSecretCallsByOrg{
+		{OrgName: "acme", Calls: []QualifiedSecretCall{{Call: "update", SecretName: "ORG_ONE"}}},
+	}, 1)
+
+	assert.Equal(t, report.Summary{Creates: 1, Updates: 2, Deletes: 2, Repos: 1, Orgs: 1}, summary)
+	assert.Equal(t, "1 create, 2 update, 2 delete across 1 repo and 1 org", summary.String())
+	assert.Equal(t, []string{"sharat87/prestige"}, manyDeletes)
+}
+
+func TestConfirmApply(t *testing.T) {
+	summary := report.Summary{Creates: 12, Updates: 40, Deletes: 3, Repos: 9}
+	out := &bytes.Buffer{}
+
+	assert.True(t, confirmApply(summary, nil, strings.NewReader("yes\n"), out))
+	assert.Contains(t, out.String(), "12 create, 40 update, 3 delete across 9 repos")
+
+	assert.False(t, confirmApply(summary, nil, strings.NewReader("y\n"), out))
+	assert.False(t, confirmApply(summary, nil, strings.NewReader(""), out))
+
+	assert.True(t, confirmApply(summary, []string{"acme/api"}, strings.NewReader("yes\nacme/api\n"), out))
+	assert.False(t, confirmApply(summary, []string{"acme/api"}, strings.NewReader("yes\nacme/web\n"), out))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Exit codes, so CI can tell what kind of failure happened. These are documented in the README, so don't change them.
+const (
+	EXIT_OK             = 0
+	EXIT_ERROR          = 1 // bad arguments, or refusing to go ahead, like when a used secret would be deleted.
+	EXIT_CHANGES        = 2 // only with `--detailed-exitcode`, when there are changes that weren't applied.
+	EXIT_CONFIG_INVALID = 3
+	EXIT_API_ERROR      = 4 // calling GitHub failed, including for bad tokens.
+	EXIT_PARTIAL_APPLY  = 5 // some of the changes couldn't be applied.
+)
+
+// Exits the process. Replaced in tests, to check the exit code instead.
+var osExit = os.Exit
+
+// An error in the config files, as opposed to one from calling GitHub.
+type ConfigError struct {
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	return e.Message
+}
+
+// The exit code for an error from computing changes. Errors not from the config are taken to be from calling GitHub.
+func exitCodeForError(err error) int {
+	var configError *ConfigError
+	if errors.As(err, &configError) {
+		return EXIT_CONFIG_INVALID
+	}
+	return EXIT_API_ERROR
+}
+
+// Log and exit with the given code, like `log.Fatalln`, but with any pending output flushed first.
+func exitWith(code int, v ...interface{}) {
+	log.Println(v...)
+	flushOutputs()
+	osExit(code)
+}
+
+func exitWithf(code int, format string, v ...interface{}) {
+	exitWith(code, fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sharat87/gass/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExitCodeForError(t *testing.T) {
+	_, _, err := resolveSecrets(nil, []string{"missing"}, nil)
+	assert.Equal(t, EXIT_CONFIG_INVALID, exitCodeForError(err))
+	assert.Equal(t, EXIT_CONFIG_INVALID, exitCodeForError(fmt.Errorf("env 'production': %w", err)))
+
+	assert.Equal(t, EXIT_API_ERROR, exitCodeForError(&github.APIError{StatusCode: 401, Message: "Bad credentials"}))
+	assert.Equal(t, EXIT_API_ERROR, exitCodeForError(errors.New("connection refused")))
+}
+
+// Stands in for exiting the process, stopping the test's call with the exit code, which `catchExit` returns.
+type exitPanic struct {
+	Code int
+}
+
+// Run `f`, and return the exit code it exits with, or -1 if it doesn't exit. Text output is returned too.
+func catchExit(t *testing.T, f func()) (code int, output string) {
+	out := &bytes.Buffer{}
+	originalExit, originalOut := osExit, textOut
+	osExit = func(code int) { panic(exitPanic{code}) }
+	textOut = out
+	t.Cleanup(func() { osExit, textOut = originalExit, originalOut })
+
+	code = -1
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				exit, ok := r.(exitPanic)
+				if !ok {
+					panic(r)
+				}
+				code = exit.Code
+			}
+		}()
+		f()
+	}()
+
+	return code, out.String()
+}
+
+func TestCheckUsedSecretsSetForDeletion(t *testing.T) {
+	code, output := catchExit(t, func() { checkUsedSecretsSetForDeletion(0, false) })
+	assert.Equal(t, -1, code)
+	assert.Empty(t, output)
+
+	code, output = catchExit(t, func() { checkUsedSecretsSetForDeletion(2, false) })
+	assert.Equal(t, EXIT_ERROR, code)
+	assert.Contains(t, output, "Exiting without doing anything")
+
+	code, output = catchExit(t, func() { checkUsedSecretsSetForDeletion(2, true) })
+	assert.Equal(t, -1, code)
+	assert.Contains(t, output, "Continuing anyway, since `--force-delete-used` was given")
+}
+
+func TestUsedDeletionsOfPlanAreRefused(t *testing.T) {
+	allChanges := []QualifiedSecretCallsByRepo{{
+		FullRepoName: "acme/api",
+		Calls:        []QualifiedSecretCall{{Call: "delete", SecretName: "NPM_TOKEN"}},
+		UsedSecrets:  map[string][]github.SecretUsage{"NPM_TOKEN": {{File: "ci.yml", Line: 4}}},
+	}}
+
+	code, _ := catchExit(t, func() { checkUsedSecretsSetForDeletion(buildPlan(allChanges, nil).UsedDeletions(), false) })
+	assert.Equal(t, EXIT_ERROR, code)
+}
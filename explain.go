@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sharat87/gass/github"
+	"github.com/sharat87/gass/parseargs"
+	"strings"
+)
+
+// Show where a secret of a repo comes from, for jobs in each of its envs, as things are on GitHub now, for
+// `gass explain`.
+func explainSecret(ia parseargs.InvokeArgs) {
+	if ia.WorkflowsFrom != "" && ia.WorkflowsRef != "" {
+		exitWith(EXIT_ERROR, "Only one of `--workflows-from` and `--workflows-ref` can be given.")
+	}
+
+	levels, err := fetchSecretLevels(ia.ExplainRepo)
+	if err != nil {
+		exitWithf(EXIT_API_ERROR, "Error getting secrets of repo '%v': %v", ia.ExplainRepo, err)
+	}
+
+	usedSecrets, err := fetchUsedSecrets(ia.ExplainRepo, SyncSpecRepo{}, ComputeOptions{WorkflowsFrom: ia.WorkflowsFrom, WorkflowsRef: ia.WorkflowsRef})
+	if err != nil {
+		exitWithf(EXIT_API_ERROR, "Error getting used secrets for repo '%v': %v", ia.ExplainRepo, err)
+	}
+
+	fmt.Fprint(textOut, formatExplanation(ia.ExplainRepo, ia.ExplainSecret, levels, usagesOf(usedSecrets, ia.ExplainSecret)))
+}
+
+// The secrets of a repo at each level, as they are on GitHub now, including all of its envs.
+func fetchSecretLevels(fullRepoName string) (secretLevels, error) {
+	levels := newSecretLevels()
+
+	orgSecrets, err := getOrgSecretListForRepo(fullRepoName)
+	if err != nil {
+		return levels, err
+	}
+	addNames(levels.Org, sortedKeys(orgSecrets))
+
+	repoSecrets, err := getSecretList(fullRepoName)
+	if err != nil {
+		return levels, err
+	}
+	addNames(levels.Repo, sortedKeys(repoSecrets))
+
+	envNames, err := github.FetchRepoEnvironments(fullRepoName)
+	if err != nil {
+		return levels, err
+	}
+
+	for _, envName := range envNames {
+		envSecrets, err := getSecretListForEnv(fullRepoName, envName)
+		if err != nil {
+			return levels, fmt.Errorf("env '%v': %w", envName, err)
+		}
+		levels.Envs[envName] = map[string]bool{}
+		addNames(levels.Envs[envName], sortedKeys(envSecrets))
+	}
+
+	return levels, nil
+}
+
+func formatExplanation(fullRepoName, secretName string, levels secretLevels, usages []github.SecretUsage) string {
+	name := strings.ToUpper(secretName)
+	lines := []string{style.Bold(secretName + " in " + fullRepoName), ""}
+
+	lines = append(lines, "Defined at:")
+	defined := []string{}
+	if github.IsBuiltInSecret(name) {
+		defined = append(defined, "GitHub (built in)")
+	}
+	if levels.Org[name] {
+		defined = append(defined, "org "+repoOwner(fullRepoName))
+	}
+	if levels.Repo[name] {
+		defined = append(defined, "repo "+fullRepoName)
+	}
+	for _, envName := range sortedKeys(levels.Envs) {
+		if levels.Envs[envName][name] {
+			defined = append(defined, "env "+envName)
+		}
+	}
+	if len(defined) == 0 {
+		defined = append(defined, style.Yellow("nowhere"))
+	}
+	for _, where := range defined {
+		lines = append(lines, "\t"+where)
+	}
+
+	lines = append(lines, "", "Comes from:")
+	lines = append(lines, "\toutside envs\t"+describeSource(levels, secretName, ""))
+	for _, envName := range sortedKeys(levels.Envs) {
+		lines = append(lines, "\tenv "+envName+"\t"+describeSource(levels, secretName, envName))
+	}
+
+	lines = append(lines, "", "Used in:")
+	if len(usages) == 0 {
+		lines = append(lines, "\t"+style.Yellow("no workflows"))
+	}
+	for _, usage := range usages {
+		source := describeSource(levels, secretName, usage.Environment)
+		if usage.IsDynamicEnvironment() {
+			source = "depends on the env"
+		}
+		lines = append(lines, "\t"+usage.String()+"\t"+source)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Like `env (overrides repo, org)`, or `not defined`.
+func describeSource(levels secretLevels, secretName, envName string) string {
+	if github.IsBuiltInSecret(secretName) {
+		return "built in"
+	}
+
+	source := levels.source(secretName, envName)
+	if source == "" {
+		return style.Red("not defined")
+	}
+
+	if shadowed := levels.shadowed(secretName, envName); len(shadowed) > 0 {
+		return source + " " + style.Highlight("(overrides "+strings.Join(shadowed, ", ")+")")
+	}
+	return source
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/sharat87/gass/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFormatExplanation(t *testing.T) {
+	levels := newSecretLevels()
+	addNames(levels.Org, []string{"NPM_TOKEN"})
+	addNames(levels.Repo, []string{"NPM_TOKEN"})
+	levels.Envs["production"] = map[string]bool{"NPM_TOKEN": true}
+	levels.Envs["staging"] = map[string]bool{}
+
+	usages := []github.SecretUsage{
+		{File: "ci.yml", Job: "test", Line: 4},
+		{File: "deploy.yml", Job: "deploy", Line: 12, Environment: "production"},
+		{File: "release.yml", Job: "release", Line: 7, Environment: "${{ inputs.env }}"},
+	}
+
+	assert.Equal(t, `NPM_TOKEN in acme/api
+
+Defined at:
+	org acme
+	repo acme/api
+	env production
+
+Comes from:
+	outside envs	repo (overrides org)
+	env production	env (overrides repo, org)
+	env staging	repo (overrides org)
+
+Used in:
+	ci.yml:4 (job test)	repo (overrides org)
+	deploy.yml:12 (job deploy, env production)	env (overrides repo, org)
+	release.yml:7 (job release, env ${{ inputs.env }})	depends on the env
+`, formatExplanation("acme/api", "NPM_TOKEN", levels, usages))
+}
+
+func TestFormatExplanationUndefined(t *testing.T) {
+	assert.Equal(t, `NPM_TOKEN in acme/api
+
+Defined at:
+	nowhere
+
+Comes from:
+	outside envs	not defined
+
+Used in:
+	no workflows
+`, formatExplanation("acme/api", "NPM_TOKEN", newSecretLevels(), nil))
+}
+
+func TestFormatExplanationBuiltIn(t *testing.T) {
+	assert.Equal(t, `github_token in acme/api
+
+Defined at:
+	GitHub (built in)
+
+Comes from:
+	outside envs	built in
+
+Used in:
+	ci.yml:3 (job test)	built in
+`, formatExplanation("acme/api", "github_token", newSecretLevels(), []github.SecretUsage{{File: "ci.yml", Job: "test", Line: 3}}))
+}
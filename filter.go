@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Restricts a run to matching repos, orgs, envs and secret names, as given with `--repo`, `--org`, `--env` and
+// `--secret`. Each of these is a list of glob patterns, and an empty list matches everything.
+type Filter struct {
+	Repos   []string
+	Orgs    []string
+	Envs    []string
+	Secrets []string
+}
+
+func (filter Filter) Validate() error {
+	for _, patterns := range [][]string{filter.Repos, filter.Orgs, filter.Envs, filter.Secrets} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid pattern '%v': %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// A repo is included if it matches `--repo`, and its owner matches `--org`.
+func (filter Filter) IncludesRepo(fullRepoName string) bool {
+	owner := strings.SplitN(fullRepoName, "/", 2)[0]
+	return matchesAny(filter.Repos, fullRepoName) && matchesAny(filter.Orgs, owner)
+}
+
+// Repo level secrets are skipped when only some envs are targeted.
+func (filter Filter) IncludesRepoSecrets() bool {
+	return len(filter.Envs) == 0
+}
+
+func (filter Filter) IncludesEnv(envName string) bool {
+	return matchesAny(filter.Envs, envName)
+}
+
+// Org secrets are skipped when only some repos or envs are targeted.
+func (filter Filter) IncludesOrg(orgName string) bool {
+	return len(filter.Repos) == 0 && len(filter.Envs) == 0 && matchesAny(filter.Orgs, orgName)
+}
+
+func (filter Filter) IncludesSecret(secretName string) bool {
+	return matchesAny(filter.Secrets, secretName)
+}
+
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if isMatch, _ := path.Match(pattern, value); isMatch {
+			return true
+		}
+	}
+
+	return false
+}
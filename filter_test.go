@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEmptyFilterIncludesEverything(t *testing.T) {
+	filter := Filter{}
+	assert.True(t, filter.IncludesRepo("acme/api"))
+	assert.True(t, filter.IncludesRepoSecrets())
+	assert.True(t, filter.IncludesEnv("production"))
+	assert.True(t, filter.IncludesOrg("acme"))
+	assert.True(t, filter.IncludesSecret("ANY"))
+}
+
+func TestFilterGlobs(t *testing.T) {
+	filter := Filter{
+		Repos:   []string{"acme/svc-*", "acme/web"},
+		Secrets: []string{"AWS_*"},
+	}
+	assert.NoError(t, filter.Validate())
+
+	assert.True(t, filter.IncludesRepo("acme/svc-one"))
+	assert.True(t, filter.IncludesRepo("acme/web"))
+	assert.False(t, filter.IncludesRepo("acme/website"))
+	assert.False(t, filter.IncludesRepo("other/svc-one"))
+	assert.False(t, filter.IncludesOrg("acme"))
+
+	assert.True(t, filter.IncludesSecret("AWS_ACCESS_KEY_ID"))
+	assert.False(t, filter.IncludesSecret("SENTRY_DSN"))
+}
+
+func TestFilterByOrg(t *testing.T) {
+	filter := Filter{Orgs: []string{"acme"}}
+	assert.True(t, filter.IncludesOrg("acme"))
+	assert.False(t, filter.IncludesOrg("other"))
+	assert.True(t, filter.IncludesRepo("acme/api"))
+	assert.False(t, filter.IncludesRepo("other/api"))
+}
+
+func TestFilterByEnv(t *testing.T) {
+	filter := Filter{Envs: []string{"prod*"}}
+	assert.False(t, filter.IncludesRepoSecrets())
+	assert.False(t, filter.IncludesOrg("acme"))
+	assert.True(t, filter.IncludesEnv("production"))
+	assert.False(t, filter.IncludesEnv("staging"))
+}
+
+func TestFilterInvalidPattern(t *testing.T) {
+	assert.Error(t, Filter{Secrets: []string{"AWS_["}}.Validate())
+}
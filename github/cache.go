@@ -0,0 +1,99 @@
+package github
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Where workflows downloaded from GitHub, and what's parsed from them, are cached, keyed by their git blob SHA. So
+// workflows that haven't changed are neither downloaded nor parsed again. Empty to not cache.
+var CacheDir string
+
+// Part of the path of cached entries, to be bumped when what's parsed from workflows changes, so old entries aren't used.
+const CACHE_VERSION = "2"
+
+// The git blob SHA of a file's content, which is what GitHub lists as the `sha` of files.
+func blobSha(content []byte) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", len(content))
+	hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func cachePath(kind, key string) string {
+	return filepath.Join(CacheDir, "workflows-v"+CACHE_VERSION, kind, key)
+}
+
+func readCache(kind, key string) ([]byte, bool) {
+	if CacheDir == "" {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(cachePath(kind, key))
+	return data, err == nil
+}
+
+// Errors are ignored, since failing to cache only makes the next run slower.
+func writeCache(kind, key string, data []byte) {
+	if CacheDir == "" {
+		return
+	}
+
+	path := cachePath(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+
+	// Written to a temporary file first, so a concurrent run never reads a partial entry.
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+}
+
+// The content of a workflow with the given blob SHA, if it's cached, and intact.
+func cachedContent(sha string) ([]byte, bool) {
+	content, ok := readCache("content", sha)
+	if !ok || blobSha(content) != sha {
+		return nil, false
+	}
+	return content, true
+}
+
+// Parse a workflow, or get what was parsed from the same content, with the same file name, in an earlier run.
+func parseWorkflowCached(filename string, content []byte) parsedWorkflow {
+	if CacheDir == "" {
+		return parseWorkflow(filename, content)
+	}
+
+	// File names of workflows in other repos have slashes, so they're hashed along with the content.
+	key := blobSha([]byte(filename + "\x00" + blobSha(content)))
+
+	if data, ok := readCache("parsed", key); ok {
+		workflow := parsedWorkflow{}
+		if err := json.Unmarshal(data, &workflow); err == nil {
+			return workflow
+		}
+	}
+
+	workflow := parseWorkflow(filename, content)
+	if data, err := json.Marshal(workflow); err == nil {
+		writeCache("parsed", key, data)
+	}
+	return workflow
+}
@@ -0,0 +1,65 @@
+package github
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlobSha(t *testing.T) {
+	// As given by `echo hello | git hash-object --stdin`.
+	assert.Equal(t, "ce013625030ba8dba906f756967f9e9ca394464a", blobSha([]byte("hello\n")))
+}
+
+func TestCachedContent(t *testing.T) {
+	CacheDir = t.TempDir()
+	defer func() { CacheDir = "" }()
+
+	content := []byte("on: push\n")
+	sha := blobSha(content)
+
+	_, ok := cachedContent(sha)
+	assert.False(t, ok)
+
+	writeCache("content", sha, content)
+	cached, ok := cachedContent(sha)
+	assert.True(t, ok)
+	assert.Equal(t, content, cached)
+
+	// Entries that don't match their SHA aren't used.
+	writeCache("content", sha, []byte("on: pull_request\n"))
+	_, ok = cachedContent(sha)
+	assert.False(t, ok)
+}
+
+func TestParseWorkflowCached(t *testing.T) {
+	CacheDir = t.TempDir()
+	defer func() { CacheDir = "" }()
+
+	content := []byte(`
+jobs:
+  deploy:
+    environment: production
+    steps:
+      - run: echo ${{ secrets.DEPLOY_KEY }}
+`)
+
+	parsed := parseWorkflowCached("deploy.yml", content)
+	assert.Equal(t, parseWorkflow("deploy.yml", content), parsed)
+
+	parsedDir := filepath.Join(CacheDir, "workflows-v"+CACHE_VERSION, "parsed")
+	entries, err := ioutil.ReadDir(parsedDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// What's parsed survives the round trip through the cache.
+	assert.Equal(t, parsed, parseWorkflowCached("deploy.yml", content))
+
+	// The cached entry is used, rather than parsing again.
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(parsedDir, entries[0].Name()), []byte(`{"File": "from-cache.yml"}`), 0o600))
+	assert.Equal(t, "from-cache.yml", parseWorkflowCached("deploy.yml", content).File)
+
+	// The same content in another file is parsed again, since usages have the file name.
+	assert.Equal(t, "ci.yml", parseWorkflowCached("ci.yml", content).Usages[0].File)
+}
@@ -9,9 +9,95 @@ func TestCollectOneSecret(t *testing.T) {
 	filesBySecret := CollectFilesBySecret(map[string][]byte{
 		"one.yaml": []byte("some random yaml content: ${{ secrets.ONE_SECRET }} here"),
 	})
-	assert.Equal(t, map[string]map[string]interface{}{
-		"ONE_SECRET": map[string]interface{}{
-			"one.yaml": nil,
+	assert.Equal(t, map[string][]SecretUsage{
+		"ONE_SECRET": {
+			{File: "one.yaml", Line: 1},
 		},
 	}, filesBySecret)
 }
+
+func TestCollectSecretsWithJobsAndSteps(t *testing.T) {
+	filesBySecret := CollectFilesBySecret(map[string][]byte{
+		"deploy.yml": []byte(`on: push
+env:
+  SHARED: ${{ secrets.SHARED }}
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    if: secrets.BUILD_ENABLED != ''
+    steps:
+      - uses: actions/checkout@v3
+      # - run: echo ${{ secrets.COMMENTED }}
+      - name: Publish
+        with:
+          token: ${{ secrets['NPM_TOKEN'] }}
+        run: |
+          echo one
+          echo ${{ secrets.NPM_TOKEN }} '${{ github.secrets.NOT_A_SECRET }}'
+      - id: notify
+        if: ${{ secrets.SLACK_HOOK && format('secrets.NOT_A_SECRET') }}
+        env:
+          HOOK: ${{ secrets.SLACK_HOOK }}
+`),
+	})
+
+	assert.Equal(t, map[string][]SecretUsage{
+		"SHARED":        {{File: "deploy.yml", Line: 3}},
+		"BUILD_ENABLED": {{File: "deploy.yml", Job: "build", Line: 7}},
+		"NPM_TOKEN": {
+			{File: "deploy.yml", Job: "build", Step: "Publish", Line: 13},
+			{File: "deploy.yml", Job: "build", Step: "Publish", Line: 16},
+		},
+		"SLACK_HOOK": {
+			{File: "deploy.yml", Job: "build", Step: "notify", Line: 18},
+			{File: "deploy.yml", Job: "build", Step: "notify", Line: 20},
+		},
+	}, filesBySecret)
+}
+
+func TestCollectSecretsWithEnvironments(t *testing.T) {
+	filesBySecret := CollectFilesBySecret(map[string][]byte{
+		"deploy.yml": []byte(`jobs:
+  deploy:
+    steps:
+      - run: deploy ${{ secrets.DEPLOY_KEY }}
+    environment: production
+  preview:
+    environment:
+      name: ${{ inputs.env }}
+      url: https://example.com
+    steps:
+      - run: preview ${{ secrets.PREVIEW_KEY }}
+`),
+	})
+
+	assert.Equal(t, map[string][]SecretUsage{
+		"DEPLOY_KEY":  {{File: "deploy.yml", Job: "deploy", Step: "#1", Line: 4, Environment: "production"}},
+		"PREVIEW_KEY": {{File: "deploy.yml", Job: "preview", Step: "#1", Line: 11, Environment: "${{ inputs.env }}"}},
+	}, filesBySecret)
+
+	assert.True(t, filesBySecret["DEPLOY_KEY"][0].IsInEnvironment("Production"))
+	assert.False(t, filesBySecret["DEPLOY_KEY"][0].IsDynamicEnvironment())
+	assert.True(t, filesBySecret["PREVIEW_KEY"][0].IsDynamicEnvironment())
+}
+
+func TestCollectSecretsFromInvalidYaml(t *testing.T) {
+	filesBySecret := CollectFilesBySecret(map[string][]byte{
+		"broken.yml": []byte("jobs:\n  build: [\n# ${{ secrets.COMMENTED }}\n    run: ${{ secrets.TOKEN }}\n"),
+	})
+	assert.Equal(t, map[string][]SecretUsage{
+		"TOKEN": {{File: "broken.yml", Line: 4}},
+	}, filesBySecret)
+}
+
+func TestSecretUsageString(t *testing.T) {
+	assert.Equal(t, "deploy.yml:12 (job deploy, step Publish)", SecretUsage{File: "deploy.yml", Job: "deploy", Step: "Publish", Line: 12}.String())
+	assert.Equal(t, "deploy.yml:3", SecretUsage{File: "deploy.yml", Line: 3}.String())
+	assert.Equal(t, "acme/api: deploy.yml:3 (job deploy)", SecretUsage{File: "deploy.yml", Job: "deploy", Line: 3, Repo: "acme/api"}.String())
+}
+
+func TestIsBuiltInSecret(t *testing.T) {
+	assert.True(t, IsBuiltInSecret("GITHUB_TOKEN"))
+	assert.True(t, IsBuiltInSecret("github_token"))
+	assert.False(t, IsBuiltInSecret("NPM_TOKEN"))
+}
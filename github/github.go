@@ -3,13 +3,14 @@ package github
 import (
 	"fmt"
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"os"
+	"path/filepath"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"regexp"
+	"net/url"
 	"strings"
 	"strconv"
 )
@@ -26,19 +27,37 @@ type GithubResponseError struct {
 	DocumentationUrl string `json:"documentation_url"`
 }
 
+// An error response from GitHub, for calls that change something.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return "HTTP " + strconv.Itoa(e.StatusCode)
+	}
+	return "HTTP " + strconv.Itoa(e.StatusCode) + ": " + e.Message
+}
+
 func MakeGitHubRequest(method, path string, body interface{}) ([]byte, error) {
+	_, responseBody, err := MakeGitHubRequestWithStatus(method, path, body)
+	return responseBody, err
+}
+
+func MakeGitHubRequestWithStatus(method, path string, body interface{}) (int, []byte, error) {
 	var requestBody io.Reader
 	if body != nil {
 		data, err := json.Marshal(body)
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
 		requestBody = bytes.NewBuffer(data)
 	}
 
 	req, err := http.NewRequest(method, "https://api.github.com/"+path, requestBody)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	req.Header.Add("Accept", "application/vnd.github.v3+json")
@@ -50,66 +69,81 @@ func MakeGitHubRequest(method, path string, body interface{}) ([]byte, error) {
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
+	defer resp.Body.Close()
 
 	responseBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return resp.StatusCode, nil, err
+	}
+
+	return resp.StatusCode, responseBody, nil
+}
+
+// Make a request that changes something, and return an `APIError` if GitHub responds with an error.
+func makeWriteRequest(method, path string, body interface{}) (int, error) {
+	status, responseBody, err := MakeGitHubRequestWithStatus(method, path, body)
+	if err != nil {
+		return status, err
 	}
 
-	return responseBody, nil
+	if status >= 300 {
+		errResponse := GithubResponseError{}
+		json.Unmarshal(responseBody, &errResponse)
+		return status, &APIError{StatusCode: status, Message: errResponse.Message}
+	}
+
+	return status, nil
 }
 
-func getRepoId(fullRepoName string) string {
+func getRepoId(fullRepoName string) (string, error) {
 	body, err := MakeGitHubRequest("GET", "repos/"+fullRepoName, nil)
 	if err != nil {
-		log.Fatalln(err)
+		return "", err
 	}
 
 	type Repo struct {
-		Id   int
+		Id int
 	}
 
 	repo := Repo{}
 	err = json.Unmarshal(body, &repo)
 	if err != nil {
-		log.Fatalln(err)
+		return "", err
+	}
+
+	if repo.Id == 0 {
+		return "", fmt.Errorf("Couldn't get the id of repo '%v'", fullRepoName)
 	}
 
-	return strconv.Itoa(repo.Id)
+	return strconv.Itoa(repo.Id), nil
 }
 
-func PutSecret(fullRepoName, secretName, keyId, encryptedValueStr string) error {
+func PutSecret(fullRepoName, secretName, keyId, encryptedValueStr string) (int, error) {
 	body := map[string]string{
 		"encrypted_value": encryptedValueStr,
 		"key_id":          keyId,
 	}
 
-	_, err := MakeGitHubRequest("PUT", "repos/"+fullRepoName+"/actions/secrets/"+secretName, body)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return makeWriteRequest("PUT", "repos/"+fullRepoName+"/actions/secrets/"+secretName, body)
 }
 
-func PutSecretForEnv(fullRepoName, envName, secretName, keyId, encryptedValueStr string) error {
+func PutSecretForEnv(fullRepoName, envName, secretName, keyId, encryptedValueStr string) (int, error) {
 	body := map[string]string{
 		"encrypted_value": encryptedValueStr,
 		"key_id":          keyId,
 	}
 
-	responseBody, err := MakeGitHubRequest("PUT", "/repositories/"+getRepoId(fullRepoName)+"/environments/"+envName+"/secrets/"+secretName, body)
+	repoId, err := getRepoId(fullRepoName)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	log.Printf("Response from put secret for env %v/%v/%v: %v", fullRepoName, envName, secretName, string(responseBody))
 
-	return nil
+	return makeWriteRequest("PUT", "repositories/"+repoId+"/environments/"+envName+"/secrets/"+secretName, body)
 }
 
-func PutSecretForOrg(name, secretName, keyId, encryptedValueStr, visibility string, selected_repository_ids []int) error {
+func PutSecretForOrg(name, secretName, keyId, encryptedValueStr, visibility string, selected_repository_ids []int) (int, error) {
 	body := map[string]interface{}{
 		"encrypted_value": encryptedValueStr,
 		"key_id":          keyId,
@@ -120,41 +154,24 @@ func PutSecretForOrg(name, secretName, keyId, encryptedValueStr, visibility stri
 		body["selected_repository_ids"] = selected_repository_ids
 	}
 
-	responseBody, err := MakeGitHubRequest("PUT", "orgs/"+name+"/actions/secrets/"+secretName, body)
-	if err != nil {
-		return err
-	}
-	// TODO: Handle potential error messages, when the response is `{"message":"Invalid request.\n\nFor 'items', \"491327810\" is not an integer.","documentation_url":"https://docs.github.com/rest/reference/actions#create-or-update-an-organization-secret"}`
-	log.Printf("Response from saving org secret %v", string(responseBody))
-
-	return nil
+	return makeWriteRequest("PUT", "orgs/"+name+"/actions/secrets/"+secretName, body)
 }
 
-func DeleteSecret(fullRepoName, secretName string) error {
-	_, err := MakeGitHubRequest("DELETE", "repos/"+fullRepoName+"/actions/secrets/"+secretName, nil)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func DeleteSecret(fullRepoName, secretName string) (int, error) {
+	return makeWriteRequest("DELETE", "repos/"+fullRepoName+"/actions/secrets/"+secretName, nil)
 }
 
-func DeleteSecretForEnv(fullRepoName, envName, secretName string) error {
-	_, err := MakeGitHubRequest("DELETE", "/repositories/"+getRepoId(fullRepoName)+"/environments/"+envName+"/secrets/"+secretName, nil)
+func DeleteSecretForEnv(fullRepoName, envName, secretName string) (int, error) {
+	repoId, err := getRepoId(fullRepoName)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return makeWriteRequest("DELETE", "repositories/"+repoId+"/environments/"+envName+"/secrets/"+secretName, nil)
 }
 
-func DeleteSecretForOrg(name, secretName string) error {
-	_, err := MakeGitHubRequest("DELETE", "orgs/"+name+"/actions/secrets/"+secretName, nil)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func DeleteSecretForOrg(name, secretName string) (int, error) {
+	return makeWriteRequest("DELETE", "orgs/"+name+"/actions/secrets/"+secretName, nil)
 }
 
 func FetchPublicKey(fullRepoName string) (PublicKey, error) {
@@ -211,24 +228,265 @@ func FetchPublicKeyForOrg(name string) (PublicKey, error) {
 	return response, nil
 }
 
-func FetchUsedSecrets(fullRepoName string) (map[string]map[string]interface{}, error) {
-	workflows, err := downloadWorkflows(fullRepoName)
+type Repo struct {
+	Id       int
+	Name     string
+	FullName string `json:"full_name"`
+	Archived bool
+	Private  bool
+	Topics   []string
+}
+
+// Fetch all repos of the given org, following pagination.
+func FetchOrgRepos(org string) ([]Repo, error) {
+	allRepos := []Repo{}
+
+	for page := 1; ; page++ {
+		body, err := MakeGitHubRequest("GET", "orgs/"+org+"/repos?per_page=100&page="+strconv.Itoa(page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		repos := []Repo{}
+		err = json.Unmarshal(body, &repos)
+		if err != nil {
+			errResponse := GithubResponseError{}
+			err := json.Unmarshal(body, &errResponse)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("Error listing repos of org '%v': %v", org, errResponse.Message)
+		}
+
+		allRepos = append(allRepos, repos...)
+
+		if len(repos) < 100 {
+			break
+		}
+	}
+
+	return allRepos, nil
+}
+
+type OrgSecret struct {
+	Name       string
+	Visibility string // "all", "private", or "selected".
+}
+
+// Fetch the secrets of an org, with which of its repos can see each.
+func FetchOrgSecrets(org string) ([]OrgSecret, error) {
+	allSecrets := []OrgSecret{}
+
+	for page := 1; ; page++ {
+		body, err := MakeGitHubRequest("GET", "orgs/"+org+"/actions/secrets?per_page=100&page="+strconv.Itoa(page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		type Response struct {
+			Secrets []OrgSecret
+			Message string
+		}
+
+		response := Response{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+
+		if response.Secrets == nil && response.Message != "" {
+			return nil, fmt.Errorf("Error listing secrets of org '%v': %v", org, response.Message)
+		}
+
+		allSecrets = append(allSecrets, response.Secrets...)
+
+		if len(response.Secrets) < 100 {
+			break
+		}
+	}
+
+	return allSecrets, nil
+}
+
+// Fetch the repos that can see an org secret whose visibility is "selected".
+func FetchSelectedReposForOrgSecret(org, secretName string) ([]Repo, error) {
+	allRepos := []Repo{}
+
+	for page := 1; ; page++ {
+		path := "orgs/" + org + "/actions/secrets/" + secretName + "/repositories?per_page=100&page=" + strconv.Itoa(page)
+		body, err := MakeGitHubRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		type Response struct {
+			Repositories []Repo
+			Message      string
+		}
+
+		response := Response{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+
+		if response.Repositories == nil && response.Message != "" {
+			return nil, fmt.Errorf("Error listing repos of org secret '%v': %v", secretName, response.Message)
+		}
+
+		allRepos = append(allRepos, response.Repositories...)
+
+		if len(response.Repositories) < 100 {
+			break
+		}
+	}
+
+	return allRepos, nil
+}
+
+// Fetch the names of a repo's environments.
+func FetchRepoEnvironments(fullRepoName string) ([]string, error) {
+	body, err := MakeGitHubRequest("GET", "repos/"+fullRepoName+"/environments?per_page=100", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	type Environment struct {
+		Name string
+	}
+
+	type Response struct {
+		Environments []Environment
+		Message      string
+	}
+
+	response := Response{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Environments == nil && response.Message != "" {
+		return nil, fmt.Errorf("Error listing environments of repo '%v': %v", fullRepoName, response.Message)
+	}
+
+	names := []string{}
+	for _, environment := range response.Environments {
+		names = append(names, environment.Name)
+	}
+	return names, nil
+}
+
+// Find the secrets used by the workflows of a repo, at the given ref, or the default branch if the ref is empty.
+func FetchUsedSecrets(fullRepoName, ref string) (map[string][]SecretUsage, error) {
+	workflows, err := downloadWorkflows(fullRepoName, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectUsedSecrets(workflows, func(repo, filePath, fileRef string) ([]byte, error) {
+		if repo == "" {
+			repo, fileRef = fullRepoName, ref
+		}
+		return FetchFileContent(repo, filePath, fileRef)
+	}, problemReporter(fullRepoName))
+}
+
+// Find the secrets used by the workflows in a local checkout of a repo. Local actions are read from the checkout too,
+// while reusable workflows from other repos are still fetched from GitHub.
+func ReadUsedSecrets(dir string) (map[string][]SecretUsage, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	workflows := map[string][]byte{}
+
+	workflowsDir := filepath.Join(dir, ".github", "workflows")
+	entries, err := ioutil.ReadDir(workflowsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isWorkflowFile(entry.Name()) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(workflowsDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		workflows[entry.Name()] = content
+	}
+
+	return collectUsedSecrets(workflows, func(repo, filePath, ref string) ([]byte, error) {
+		if repo == "" {
+			return ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(filePath)))
+		}
+		return FetchFileContent(repo, filePath, ref)
+	}, problemReporter(dir))
+}
+
+// Reports problems with `ReportProblem`, saying where the workflows are from, if it's set.
+func problemReporter(where string) func(string) {
+	if ReportProblem == nil {
+		return nil
+	}
+	return func(problem string) {
+		ReportProblem(where + ": " + problem)
+	}
+}
+
+func isWorkflowFile(name string) bool {
+	return strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".yaml")
+}
+
+// Fetch a file from a repo, at the given ref, or the default branch if the ref is empty.
+func FetchFileContent(repo, filePath, ref string) ([]byte, error) {
+	query := ""
+	if ref != "" {
+		query = "?ref=" + url.QueryEscape(ref)
+	}
+
+	body, err := MakeGitHubRequest("GET", "repos/"+repo+"/contents/"+filePath+query, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return CollectFilesBySecret(workflows), nil
+	type Response struct {
+		Content  string
+		Encoding string
+		Message  string
+	}
+
+	response := Response{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Encoding != "base64" {
+		if response.Message != "" {
+			return nil, fmt.Errorf("Error fetching file '%v' in '%v': %v", filePath, repo, response.Message)
+		}
+		return nil, fmt.Errorf("Unexpected encoding '%v' of file '%v' in '%v'", response.Encoding, filePath, repo)
+	}
+
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(response.Content, "\n", ""))
 }
 
-func downloadWorkflows(repo string) (map[string][]byte, error) {
+func downloadWorkflows(repo, ref string) (map[string][]byte, error) {
 	type Item struct {
 		Name        string
+		Sha         string
 		DownloadURL string `json:"download_url"`
 	}
 
 	workflows := map[string][]byte{}
 
-	body, _ := MakeGitHubRequest("GET", "repos/"+repo+"/contents/.github/workflows", nil)
+	query := ""
+	if ref != "" {
+		query = "?ref=" + url.QueryEscape(ref)
+	}
+
+	body, _ := MakeGitHubRequest("GET", "repos/"+repo+"/contents/.github/workflows"+query, nil)
 
 	items := []Item{}
 	err := json.Unmarshal(body, &items)
@@ -252,7 +510,12 @@ func downloadWorkflows(repo string) (map[string][]byte, error) {
 	}
 
 	for _, item := range items {
-		if !strings.HasSuffix(item.Name, ".yml") && !strings.HasSuffix(item.Name, ".yaml") {
+		if !isWorkflowFile(item.Name) {
+			continue
+		}
+
+		if content, ok := cachedContent(item.Sha); ok {
+			workflows[item.Name] = content
 			continue
 		}
 
@@ -262,29 +525,16 @@ func downloadWorkflows(repo string) (map[string][]byte, error) {
 		}
 
 		responseBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
 			return nil, err
 		}
 
 		workflows[item.Name] = responseBody
-	}
-
-	return workflows, nil
-}
-
-func CollectFilesBySecret(workflows map[string][]byte) map[string]map[string]interface{} {
-	filesBySecret := map[string]map[string]interface{}{}
-	secretsPat := regexp.MustCompile(`\${{\s*secrets\.([^}\s]+)\s*}}`)
-
-	for filename, content := range workflows {
-		for _, match := range secretsPat.FindAllSubmatch(content, -1) {
-			secretName := string(match[1])
-			if _, ok := filesBySecret[secretName]; !ok {
-				filesBySecret[secretName] = map[string]interface{}{}
-			}
-			filesBySecret[secretName][filename] = nil
+		if resp.StatusCode == http.StatusOK && blobSha(responseBody) == item.Sha {
+			writeCache("content", item.Sha, responseBody)
 		}
 	}
 
-	return filesBySecret
+	return workflows, nil
 }
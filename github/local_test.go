@@ -0,0 +1,36 @@
+package github
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadUsedSecrets(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".github/workflows/deploy.yml":       "jobs:\n  deploy:\n    steps:\n      - uses: ./.github/actions/publish\n        with:\n          token: ${{ secrets.NPM_TOKEN }}\n",
+		".github/workflows/README.md":        "Not a workflow, ${{ secrets.README }}",
+		".github/actions/publish/action.yml": "inputs:\n  token: {}\nruns:\n  using: composite\n  steps:\n    - run: publish ${{ inputs.token }}\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	usages, err := ReadUsedSecrets(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]SecretUsage{
+		"NPM_TOKEN": {{File: "deploy.yml", Job: "deploy", Step: "#1", Line: 6, Via: ".github/actions/publish/action.yml:6 (step #1)"}},
+	}, usages)
+}
+
+func TestReadUsedSecretsWithoutWorkflows(t *testing.T) {
+	usages, err := ReadUsedSecrets(t.TempDir())
+	assert.NoError(t, err)
+	assert.Empty(t, usages)
+
+	_, err = ReadUsedSecrets(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package github
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// What we need to know of a local action, like `./.github/actions/deploy`, to see where its inputs are used.
+type parsedAction struct {
+	File   string
+	Using  string         // like `composite`, `node16` or `docker`.
+	Inputs map[string]int // line of each input's declaration.
+	Usages []namedUsage   // references to inputs, in the steps of composite actions, with `Secret` being the input.
+}
+
+func parseAction(filename string, content []byte) (parsedAction, error) {
+	action := parsedAction{File: filename, Inputs: map[string]int{}, Usages: []namedUsage{}}
+
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return action, err
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return action, fmt.Errorf("Action '%v' is not a mapping", filename)
+	}
+	root := document.Content[0]
+
+	if inputs := mappingValue(root, "inputs"); inputs != nil && inputs.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(inputs.Content); i += 2 {
+			action.Inputs[inputs.Content[i].Value] = inputs.Content[i].Line
+		}
+	}
+
+	runs := mappingValue(root, "runs")
+	if runs == nil || runs.Kind != yaml.MappingNode {
+		return action, nil
+	}
+
+	if using := mappingValue(runs, "using"); using != nil {
+		action.Using = using.Value
+	}
+
+	if steps := mappingValue(runs, "steps"); steps != nil && steps.Kind == yaml.SequenceNode {
+		for index, step := range steps.Content {
+			step = resolveAlias(step)
+			collectStep(step, "inputs", SecretUsage{File: filename, Step: stepName(step, index)}, func(usage namedUsage) {
+				action.Usages = append(action.Usages, usage)
+			})
+		}
+	}
+
+	return action, nil
+}
+
+// Load and parse a local action, from its `action.yml`, or `action.yaml`. Returns false if there's no fetcher, or the
+// action couldn't be loaded. That's not an error, since the secrets passed to the action are known to be used anyway,
+// and local actions may come from a repo checked out by an earlier step, rather than the workflow's own repo.
+func (r *workflowResolver) loadAction(ref workflowRef) (parsedAction, bool) {
+	if action, ok := r.actions[ref.String()]; ok {
+		return action, action.File != ""
+	}
+
+	if r.fetch == nil {
+		return parsedAction{}, false
+	}
+
+	action := parsedAction{}
+	for _, name := range []string{"action.yml", "action.yaml"} {
+		fileRef := workflowRef{Repo: ref.Repo, Path: strings.TrimSuffix(ref.Path, "/") + "/" + name, Ref: ref.Ref}
+		if content, err := r.fetch(fileRef.Repo, fileRef.Path, fileRef.Ref); err == nil {
+			if action, err = parseAction(fileRef.String(), content); err != nil {
+				action = parsedAction{}
+			}
+			break
+		}
+	}
+
+	// Failures are remembered too, so they aren't fetched again.
+	r.actions[ref.String()] = action
+	return action, action.File != ""
+}
+
+// Follow the secrets passed to local actions with `with`, to where the action uses them. Each place an input is used
+// becomes a usage of the secret. Usages not passed to local actions, or those whose actions can't be looked into, are
+// returned as they are.
+func (r *workflowResolver) traceIntoActions(usages []namedUsage, from workflowRef, depth int) ([]namedUsage, error) {
+	traced := []namedUsage{}
+
+	for _, usage := range usages {
+		if usage.Action == "" {
+			traced = append(traced, usage)
+			continue
+		}
+
+		locations, err := r.inputLocations(usage.Action, usage.Input, from, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(locations) == 0 {
+			traced = append(traced, usage)
+		}
+		for _, location := range locations {
+			usageInAction := usage
+			usageInAction.Via = location
+			traced = append(traced, usageInAction)
+		}
+	}
+
+	return traced, nil
+}
+
+// Where an input of a local action is used, including in local actions that it passes the input on to. For actions
+// that aren't composite, this is where the input is declared, since its code is what uses it.
+func (r *workflowResolver) inputLocations(uses, input string, from workflowRef, depth int) ([]string, error) {
+	if depth >= MAX_WORKFLOW_DEPTH {
+		return nil, fmt.Errorf("Local actions are nested more than %v levels deep, at '%v'", MAX_WORKFLOW_DEPTH, uses)
+	}
+
+	ref := workflowRef{Repo: from.Repo, Path: strings.TrimPrefix(uses, "./"), Ref: from.Ref}
+	action, ok := r.loadAction(ref)
+	if !ok {
+		return nil, nil
+	}
+
+	locations := []string{}
+
+	if action.Using != "composite" {
+		for name, line := range action.Inputs {
+			if strings.EqualFold(name, input) {
+				locations = append(locations, fmt.Sprintf("%v:%v (input %v)", action.File, line, name))
+			}
+		}
+		return locations, nil
+	}
+
+	for _, usage := range action.Usages {
+		if !strings.EqualFold(usage.Secret, input) {
+			continue
+		}
+
+		if usage.Action == "" {
+			locations = append(locations, usage.String())
+			continue
+		}
+
+		nested, err := r.inputLocations(usage.Action, usage.Input, ref, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(nested) == 0 {
+			locations = append(locations, usage.String())
+		}
+		for _, location := range nested {
+			locations = append(locations, usage.String()+" via "+location)
+		}
+	}
+
+	return locations, nil
+}
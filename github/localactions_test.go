@@ -0,0 +1,66 @@
+package github
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCollectUsedSecretsFromLocalActions(t *testing.T) {
+	workflows := map[string][]byte{
+		"deploy.yml": []byte(`jobs:
+  deploy:
+    steps:
+      - name: Publish
+        uses: ./.github/actions/publish
+        with:
+          token: ${{ secrets.NPM_TOKEN }}
+          registry: ${{ secrets.REGISTRY }}
+      - uses: ./.github/actions/missing
+        with:
+          key: ${{ secrets.MISSING_ACTION_KEY }}
+`),
+	}
+
+	files := map[string]string{
+		".github/actions/publish/action.yml": `inputs:
+  token:
+    required: true
+  registry: {}
+runs:
+  using: composite
+  steps:
+    - name: Login
+      run: npm login --token ${{ inputs.token }}
+    - uses: ./.github/actions/notify
+      with:
+        hook: ${{ inputs.TOKEN }}
+`,
+		".github/actions/notify/action.yaml": `inputs:
+  hook: {}
+runs:
+  using: node16
+  main: index.js
+`,
+	}
+
+	fetch := func(repo, filePath, ref string) ([]byte, error) {
+		if content, ok := files[filePath]; ok && repo == "" {
+			return []byte(content), nil
+		}
+		return nil, errors.New("Not Found")
+	}
+
+	usages, err := CollectUsedSecrets(workflows, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]SecretUsage{
+		"NPM_TOKEN": {
+			{File: "deploy.yml", Job: "deploy", Step: "Publish", Line: 7, Via: ".github/actions/publish/action.yml:12 (step #2) via .github/actions/notify/action.yaml:2 (input hook)"},
+			{File: "deploy.yml", Job: "deploy", Step: "Publish", Line: 7, Via: ".github/actions/publish/action.yml:9 (step Login)"},
+		},
+		// Passed to an input that the action doesn't use.
+		"REGISTRY": {{File: "deploy.yml", Job: "deploy", Step: "Publish", Line: 8}},
+		// The action couldn't be fetched, so the secret is only known to be passed to it.
+		"MISSING_ACTION_KEY": {{File: "deploy.yml", Job: "deploy", Step: "#2", Line: 11}},
+	}, usages)
+}
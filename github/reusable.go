@@ -0,0 +1,205 @@
+package github
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// GitHub allows reusable workflows to be nested up to this many levels, counting the top level caller.
+const MAX_WORKFLOW_DEPTH = 10
+
+// Fetches a file from a repo, at the given ref, or the default branch if the ref is empty. An empty repo is the repo
+// whose workflows are being looked into.
+type FileFetcher func(repo, filePath, ref string) ([]byte, error)
+
+// Where a reusable workflow, or a local action, lives. An empty repo is the repo whose workflows are being looked into,
+// whose workflows are known already, and need not be fetched.
+type workflowRef struct {
+	Repo string
+	Path string
+	Ref  string
+}
+
+func (r workflowRef) String() string {
+	if r.Repo == "" {
+		return strings.TrimPrefix(r.Path, ".github/workflows/")
+	} else if r.Ref == "" {
+		return r.Repo + "/" + r.Path
+	}
+	return r.Repo + "/" + r.Path + "@" + r.Ref
+}
+
+// Resolve the `uses` of a job, relative to the workflow it's in. Local workflows, like `./.github/workflows/x.yml`, are
+// from the same repo and ref as the calling workflow.
+func parseWorkflowUses(uses string, from workflowRef) (workflowRef, error) {
+	if strings.HasPrefix(uses, "./") {
+		return workflowRef{Repo: from.Repo, Path: strings.TrimPrefix(uses, "./"), Ref: from.Ref}, nil
+	}
+
+	location, ref, hasRef := strings.Cut(uses, "@")
+	parts := strings.SplitN(location, "/", 3)
+	if !hasRef || ref == "" || len(parts) < 3 || parts[0] == "" || parts[1] == "" {
+		return workflowRef{}, fmt.Errorf("Invalid reusable workflow '%v', should be like `owner/repo/path@ref`", uses)
+	}
+
+	return workflowRef{Repo: parts[0] + "/" + parts[1], Path: parts[2], Ref: ref}, nil
+}
+
+type workflowResolver struct {
+	local   map[string][]byte // workflows of the repo being looked into, by file name.
+	fetch   FileFetcher       // nil to only follow local workflows.
+	parsed  map[string]parsedWorkflow
+	actions map[string]parsedAction
+
+	reportProblem func(string) // nil to not look for problems.
+	reported      map[string]bool
+}
+
+func newWorkflowResolver(local map[string][]byte, fetch FileFetcher) *workflowResolver {
+	return &workflowResolver{local: local, fetch: fetch, parsed: map[string]parsedWorkflow{}, actions: map[string]parsedAction{}, reported: map[string]bool{}}
+}
+
+// Load and parse a called workflow. Returns false if it's in another repo, and there's no fetcher.
+func (r *workflowResolver) load(ref workflowRef) (parsedWorkflow, bool, error) {
+	if workflow, ok := r.parsed[ref.String()]; ok {
+		return workflow, true, nil
+	}
+
+	var content []byte
+	if ref.Repo == "" {
+		var ok bool
+		content, ok = r.local[path.Base(ref.Path)]
+		if !ok || path.Dir(ref.Path) != ".github/workflows" {
+			return parsedWorkflow{}, false, fmt.Errorf("Called workflow '%v' not found", ref.Path)
+		}
+
+	} else if r.fetch == nil {
+		return parsedWorkflow{}, false, nil
+
+	} else {
+		var err error
+		content, err = r.fetch(ref.Repo, ref.Path, ref.Ref)
+		if err != nil {
+			return parsedWorkflow{}, false, fmt.Errorf("Error fetching called workflow '%v': %v", ref, err)
+		}
+	}
+
+	workflow := parseWorkflowCached(ref.String(), content)
+	r.parsed[ref.String()] = workflow
+	return workflow, true, nil
+}
+
+// The secrets used by the reusable workflows that the given workflow calls with `secrets: inherit`, attributed to the
+// calling jobs. Those called with explicit `secrets:` aren't followed, since the secrets passed in are already usages
+// in the calling job, but they are checked for passing all the secrets the called workflow requires. Secrets declared
+// with `required: true` by called workflows count as used, even if the called workflow only passes them on.
+func (r *workflowResolver) inheritedUsages(workflow parsedWorkflow, from workflowRef, depth int) (map[string][]SecretUsage, error) {
+	inherited := map[string][]SecretUsage{}
+
+	for _, call := range workflow.Calls {
+		if !call.Inherit {
+			r.checkPassedSecrets(workflow, call, from)
+			continue
+		}
+
+		if depth >= MAX_WORKFLOW_DEPTH {
+			return nil, fmt.Errorf("Reusable workflows are nested more than %v levels deep, at '%v'", MAX_WORKFLOW_DEPTH, call.Uses)
+		}
+
+		ref, err := parseWorkflowUses(call.Uses, from)
+		if err != nil {
+			return nil, err
+		}
+
+		called, ok, err := r.load(ref)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		calledUsages, err := r.traceIntoActions(called.Usages, ref, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		usagesInCalled := map[string][]SecretUsage{}
+		for _, usage := range calledUsages {
+			usagesInCalled[usage.Secret] = append(usagesInCalled[usage.Secret], usage.SecretUsage)
+		}
+
+		nested, err := r.inheritedUsages(called, ref, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		for name, usages := range nested {
+			usagesInCalled[name] = append(usagesInCalled[name], usages...)
+		}
+
+		for name, declared := range called.Declared {
+			if _, ok := usagesInCalled[name]; !ok && declared.Required {
+				usagesInCalled[name] = []SecretUsage{{File: called.File, Line: declared.Line}}
+			}
+		}
+
+		for name, usages := range usagesInCalled {
+			for _, usage := range usages {
+				inherited[name] = append(inherited[name], SecretUsage{
+					File:        workflow.File,
+					Job:         call.Job,
+					Line:        call.Line,
+					Environment: usage.Environment,
+					Via:         usage.String(),
+				})
+			}
+		}
+	}
+
+	return inherited, nil
+}
+
+// Report the secrets that a called workflow declares with `required: true`, but that the calling job doesn't pass, since
+// the job fails when it runs. Called workflows that can't be loaded aren't checked, as they don't affect used secrets.
+func (r *workflowResolver) checkPassedSecrets(workflow parsedWorkflow, call workflowCall, from workflowRef) {
+	if r.reportProblem == nil {
+		return
+	}
+
+	ref, err := parseWorkflowUses(call.Uses, from)
+	if err != nil {
+		return
+	}
+
+	called, ok, err := r.load(ref)
+	if err != nil || !ok {
+		return
+	}
+
+	names := []string{}
+	for name, declared := range called.Declared {
+		if declared.Required && !containsFold(call.Passed, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		problem := fmt.Sprintf("%v:%v (job %v) doesn't pass the secret '%v', which '%v' requires", workflow.File, call.Line, call.Job, name, ref)
+		if !r.reported[problem] {
+			r.reported[problem] = true
+			r.reportProblem(problem)
+		}
+	}
+}
+
+// If the list has the name, ignoring case, like secret names.
+func containsFold(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
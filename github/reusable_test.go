@@ -0,0 +1,171 @@
+package github
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCollectUsedSecretsFromReusableWorkflows(t *testing.T) {
+	workflows := map[string][]byte{
+		"ci.yml": []byte(`jobs:
+  deploy:
+    uses: acme/workflows/.github/workflows/deploy.yml@main
+    secrets: inherit
+  test:
+    uses: ./.github/workflows/test.yml
+    secrets:
+      token: ${{ secrets.TEST_TOKEN }}
+`),
+		"test.yml": []byte(`on:
+  workflow_call:
+    secrets:
+      token:
+        required: true
+jobs:
+  test:
+    steps:
+      - run: test ${{ secrets.token }}
+`),
+	}
+
+	fetched := []string{}
+	fetch := func(repo, filePath, ref string) ([]byte, error) {
+		fetched = append(fetched, repo+" "+filePath+" "+ref)
+		switch filePath {
+		case ".github/workflows/deploy.yml":
+			return []byte(`on:
+  workflow_call:
+    secrets:
+      DEPLOY_KEY:
+        required: true
+      OPTIONAL_KEY:
+        required: false
+jobs:
+  deploy:
+    environment: production
+    steps:
+      - run: deploy ${{ secrets.NPM_TOKEN }}
+  notify:
+    uses: ./.github/workflows/notify.yml
+    secrets: inherit
+`), nil
+		case ".github/workflows/notify.yml":
+			return []byte(`jobs:
+  notify:
+    steps:
+      - run: notify ${{ secrets.SLACK_HOOK }}
+`), nil
+		}
+		return nil, errors.New("Not Found")
+	}
+
+	usages, err := CollectUsedSecrets(workflows, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]SecretUsage{
+		"TEST_TOKEN": {{File: "ci.yml", Job: "test", Line: 8}},
+		"token":      {{File: "test.yml", Job: "test", Step: "#1", Line: 9}},
+		"DEPLOY_KEY": {{File: "ci.yml", Job: "deploy", Line: 3, Via: "acme/workflows/.github/workflows/deploy.yml@main:4"}},
+		"NPM_TOKEN": {{
+			File:        "ci.yml",
+			Job:         "deploy",
+			Line:        3,
+			Environment: "production",
+			Via:         "acme/workflows/.github/workflows/deploy.yml@main:12 (job deploy, env production, step #1)",
+		}},
+		"SLACK_HOOK": {{
+			File: "ci.yml",
+			Job:  "deploy",
+			Line: 3,
+			Via:  "acme/workflows/.github/workflows/deploy.yml@main:14 (job notify) via acme/workflows/.github/workflows/notify.yml@main:4 (job notify, step #1)",
+		}},
+	}, usages)
+
+	assert.Equal(t, []string{
+		"acme/workflows .github/workflows/deploy.yml main",
+		"acme/workflows .github/workflows/notify.yml main",
+	}, fetched)
+
+	// Without a fetcher, workflows in other repos aren't followed.
+	assert.NotContains(t, CollectFilesBySecret(workflows), "NPM_TOKEN")
+}
+
+func TestCollectUsedSecretsErrors(t *testing.T) {
+	_, err := CollectUsedSecrets(map[string][]byte{
+		"ci.yml": []byte("jobs:\n  deploy:\n    uses: acme/workflows/.github/workflows/missing.yml@main\n    secrets: inherit\n"),
+	}, func(repo, filePath, ref string) ([]byte, error) {
+		return nil, errors.New("Not Found")
+	})
+	assert.EqualError(t, err, "Error following reusable workflows in 'ci.yml': Error fetching called workflow 'acme/workflows/.github/workflows/missing.yml@main': Not Found")
+
+	_, err = CollectUsedSecrets(map[string][]byte{
+		"loop.yml": []byte("jobs:\n  again:\n    uses: ./.github/workflows/loop.yml\n    secrets: inherit\n"),
+	}, nil)
+	assert.EqualError(t, err, "Error following reusable workflows in 'loop.yml': Reusable workflows are nested more than 10 levels deep, at './.github/workflows/loop.yml'")
+}
+
+func TestParseWorkflowUses(t *testing.T) {
+	from := workflowRef{Repo: "acme/workflows", Path: ".github/workflows/deploy.yml", Ref: "v1"}
+
+	ref, err := parseWorkflowUses("./.github/workflows/notify.yml", from)
+	assert.NoError(t, err)
+	assert.Equal(t, workflowRef{Repo: "acme/workflows", Path: ".github/workflows/notify.yml", Ref: "v1"}, ref)
+
+	ref, err = parseWorkflowUses("octo/shared/.github/workflows/build.yml@0123abc", from)
+	assert.NoError(t, err)
+	assert.Equal(t, workflowRef{Repo: "octo/shared", Path: ".github/workflows/build.yml", Ref: "0123abc"}, ref)
+
+	_, err = parseWorkflowUses("octo/shared/.github/workflows/build.yml", from)
+	assert.Error(t, err)
+}
+
+func TestCollectUsedSecretsReportsUnpassedRequiredSecrets(t *testing.T) {
+	workflows := map[string][]byte{
+		"ci.yml": []byte(`jobs:
+  deploy:
+    uses: acme/workflows/.github/workflows/deploy.yml@main
+    secrets:
+      deploy_key: ${{ secrets.DEPLOY_KEY }}
+  test:
+    uses: ./.github/workflows/test.yml
+`),
+		"test.yml": []byte(`on:
+  workflow_call:
+    secrets:
+      token:
+        required: true
+jobs:
+  test:
+    steps:
+      - run: test ${{ secrets.token }}
+`),
+	}
+
+	fetch := func(repo, filePath, ref string) ([]byte, error) {
+		return []byte(`on:
+  workflow_call:
+    secrets:
+      DEPLOY_KEY:
+        required: true
+      NPM_TOKEN:
+        required: true
+      OPTIONAL_KEY:
+        required: false
+jobs:
+  deploy:
+    steps:
+      - run: deploy
+`), nil
+	}
+
+	problems := []string{}
+	_, err := collectUsedSecrets(workflows, fetch, func(problem string) {
+		problems = append(problems, problem)
+	})
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"ci.yml:3 (job deploy) doesn't pass the secret 'NPM_TOKEN', which 'acme/workflows/.github/workflows/deploy.yml@main' requires",
+		"ci.yml:7 (job test) doesn't pass the secret 'token', which 'test.yml' requires",
+	}, problems)
+}
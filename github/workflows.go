@@ -0,0 +1,542 @@
+package github
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Secrets that GitHub provides to every workflow run. They can't be created, so they're never missing, or unused.
+var BUILT_IN_SECRETS = []string{"GITHUB_TOKEN"}
+
+// If the secret is provided by GitHub. Secret names are case insensitive.
+func IsBuiltInSecret(name string) bool {
+	for _, builtIn := range BUILT_IN_SECRETS {
+		if strings.EqualFold(name, builtIn) {
+			return true
+		}
+	}
+	return false
+}
+
+// A place in a workflow where a secret is used.
+type SecretUsage struct {
+	File string
+	Job  string // id of the job, empty if used outside of jobs, like in the workflow's `env`.
+	Step string // name of the step, or its id, or its position like `#2`. Empty if not used in a step.
+	Line int
+
+	// The `environment` of the job, if any. May have an expression, like `${{ inputs.env }}`, if it's only known when
+	// the workflow runs.
+	Environment string
+
+	// Where the secret is used in the called workflow, if it's used through a reusable workflow, with `secrets: inherit`.
+	Via string
+
+	// The repo of the workflow, like `acme/api`. Only set for usages of org secrets, which span many repos.
+	Repo string
+}
+
+// If the environment is only known when the workflow runs, so the secret could come from any environment.
+func (u SecretUsage) IsDynamicEnvironment() bool {
+	return strings.Contains(u.Environment, "${{")
+}
+
+// If the secret is used by a job that runs in the given environment. Environment names are case insensitive.
+func (u SecretUsage) IsInEnvironment(envName string) bool {
+	return strings.EqualFold(u.Environment, envName)
+}
+
+func (u SecretUsage) String() string {
+	where := []string{}
+	if u.Job != "" {
+		where = append(where, "job "+u.Job)
+	}
+	if u.Environment != "" {
+		where = append(where, "env "+u.Environment)
+	}
+	if u.Step != "" {
+		where = append(where, "step "+u.Step)
+	}
+
+	location := fmt.Sprintf("%v:%v", u.File, u.Line)
+	if u.Repo != "" {
+		location = u.Repo + ": " + location
+	}
+	if len(where) > 0 {
+		location += " (" + strings.Join(where, ", ") + ")"
+	}
+	if u.Via != "" {
+		location += " via " + u.Via
+	}
+	return location
+}
+
+// Find where secrets are used in the given workflows, which are keyed by their file name. Workflows are parsed as YAML,
+// so commented out lines are ignored, and each usage knows its job and step. Workflows that aren't valid YAML are
+// searched for `${{ secrets.* }}` as plain text instead, so their usages are still known, only less precisely.
+// Reusable workflows are only followed if they are in the given workflows, use `CollectUsedSecrets` to fetch others.
+// Built-in secrets, like `GITHUB_TOKEN`, are included too, use `IsBuiltInSecret` to tell them apart.
+func CollectFilesBySecret(workflows map[string][]byte) map[string][]SecretUsage {
+	usagesBySecret, _ := CollectUsedSecrets(workflows, nil)
+	return usagesBySecret
+}
+
+// Called with problems found in workflows while finding the secrets they use, that fail them when they run, like
+// required secrets that a job doesn't pass to the workflow it calls. Nil to not look for problems.
+var ReportProblem func(problem string)
+
+// Like `CollectFilesBySecret`, but also follows reusable workflows in other repos, fetching them with `fetch`.
+func CollectUsedSecrets(workflows map[string][]byte, fetch FileFetcher) (map[string][]SecretUsage, error) {
+	return collectUsedSecrets(workflows, fetch, nil)
+}
+
+// Like `CollectUsedSecrets`, with problems in the workflows given to `reportProblem`, if it isn't nil.
+func collectUsedSecrets(workflows map[string][]byte, fetch FileFetcher, reportProblem func(string)) (map[string][]SecretUsage, error) {
+	resolver := newWorkflowResolver(workflows, fetch)
+	resolver.reportProblem = reportProblem
+	usagesBySecret := map[string][]SecretUsage{}
+
+	for filename, content := range workflows {
+		workflow := parseWorkflowCached(filename, content)
+
+		usages, err := resolver.traceIntoActions(workflow.Usages, workflowRef{}, 1)
+		if err != nil {
+			return nil, fmt.Errorf("Error following local actions in '%v': %v", filename, err)
+		}
+		for _, usage := range usages {
+			usagesBySecret[usage.Secret] = append(usagesBySecret[usage.Secret], usage.SecretUsage)
+		}
+
+		inherited, err := resolver.inheritedUsages(workflow, workflowRef{}, 1)
+		if err != nil {
+			return nil, fmt.Errorf("Error following reusable workflows in '%v': %v", filename, err)
+		}
+		for name, usages := range inherited {
+			usagesBySecret[name] = append(usagesBySecret[name], usages...)
+		}
+	}
+
+	for _, usages := range usagesBySecret {
+		sortUsages(usages)
+	}
+
+	return usagesBySecret, nil
+}
+
+func sortUsages(usages []SecretUsage) {
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].File != usages[j].File {
+			return usages[i].File < usages[j].File
+		} else if usages[i].Line != usages[j].Line {
+			return usages[i].Line < usages[j].Line
+		}
+		return usages[i].Via < usages[j].Via
+	})
+}
+
+type namedUsage struct {
+	Secret string
+	SecretUsage
+
+	// The local action, like `./.github/actions/deploy`, and its input, if the secret is passed to one with `with`.
+	Action string
+	Input  string
+}
+
+// What we need to know of a workflow, to find the secrets it uses.
+type parsedWorkflow struct {
+	File     string
+	Usages   []namedUsage
+	Calls    []workflowCall
+	Declared map[string]declaredSecret // secrets declared in `on.workflow_call.secrets`, for reusable workflows.
+}
+
+// A job that calls a reusable workflow.
+type workflowCall struct {
+	Job     string
+	Line    int
+	Uses    string   // like `owner/repo/.github/workflows/deploy.yml@main`, or `./.github/workflows/deploy.yml`.
+	Inherit bool     // if the job has `secrets: inherit`.
+	Passed  []string // names of the secrets passed with an explicit `secrets:` mapping.
+}
+
+type declaredSecret struct {
+	Line     int
+	Required bool
+}
+
+// Parse a workflow, falling back to scanning it as plain text, if it isn't valid YAML.
+func parseWorkflow(filename string, content []byte) parsedWorkflow {
+	workflow, err := parseWorkflowYaml(filename, content)
+	if err != nil {
+		workflow = parsedWorkflow{File: filename, Usages: scanWorkflowUsages(filename, content)}
+	}
+	return workflow
+}
+
+func parseWorkflowYaml(filename string, content []byte) (parsedWorkflow, error) {
+	workflow := parsedWorkflow{File: filename, Usages: []namedUsage{}, Calls: []workflowCall{}, Declared: map[string]declaredSecret{}}
+
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return workflow, err
+	}
+
+	if len(document.Content) == 0 {
+		return workflow, nil
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return workflow, fmt.Errorf("Workflow '%v' is not a mapping", filename)
+	}
+
+	add := func(usage namedUsage) {
+		workflow.Usages = append(workflow.Usages, usage)
+	}
+
+	collect := func(node *yaml.Node, isExpression bool, job, environment string) {
+		walkExpressions(node, "secrets", isExpression, func(secret string, line int) {
+			add(namedUsage{Secret: secret, SecretUsage: SecretUsage{File: filename, Job: job, Line: line, Environment: environment}})
+		})
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "on" {
+			workflow.Declared = declaredSecrets(resolveAlias(root.Content[i+1]))
+		}
+
+		if root.Content[i].Value != "jobs" || root.Content[i+1].Kind != yaml.MappingNode {
+			collect(root.Content[i+1], false, "", "")
+			continue
+		}
+
+		jobs := root.Content[i+1]
+		for j := 0; j+1 < len(jobs.Content); j += 2 {
+			jobId, job := jobs.Content[j].Value, resolveAlias(jobs.Content[j+1])
+			if job.Kind != yaml.MappingNode {
+				continue
+			}
+
+			environment := jobEnvironment(job)
+
+			if uses := mappingValue(job, "uses"); uses != nil && uses.Kind == yaml.ScalarNode {
+				secrets := mappingValue(job, "secrets")
+				call := workflowCall{
+					Job:     jobId,
+					Line:    uses.Line,
+					Uses:    strings.TrimSpace(uses.Value),
+					Inherit: secrets != nil && secrets.Kind == yaml.ScalarNode && secrets.Value == "inherit",
+				}
+				if secrets != nil && secrets.Kind == yaml.MappingNode {
+					for k := 0; k+1 < len(secrets.Content); k += 2 {
+						call.Passed = append(call.Passed, secrets.Content[k].Value)
+					}
+				}
+				workflow.Calls = append(workflow.Calls, call)
+			}
+
+			for k := 0; k+1 < len(job.Content); k += 2 {
+				steps := resolveAlias(job.Content[k+1])
+				if job.Content[k].Value != "steps" || steps.Kind != yaml.SequenceNode {
+					collect(job.Content[k+1], job.Content[k].Value == "if", jobId, environment)
+					continue
+				}
+
+				for index, step := range steps.Content {
+					collectStep(resolveAlias(step), "secrets", SecretUsage{File: filename, Job: jobId, Step: stepName(resolveAlias(step), index), Environment: environment}, add)
+				}
+			}
+		}
+	}
+
+	return workflow, nil
+}
+
+// The secrets declared by a reusable workflow, under `on.workflow_call.secrets`.
+func declaredSecrets(on *yaml.Node) map[string]declaredSecret {
+	declared := map[string]declaredSecret{}
+	if on.Kind != yaml.MappingNode {
+		return declared
+	}
+
+	workflowCall := mappingValue(on, "workflow_call")
+	if workflowCall == nil || workflowCall.Kind != yaml.MappingNode {
+		return declared
+	}
+
+	secrets := mappingValue(workflowCall, "secrets")
+	if secrets == nil || secrets.Kind != yaml.MappingNode {
+		return declared
+	}
+
+	for i := 0; i+1 < len(secrets.Content); i += 2 {
+		secret := declaredSecret{Line: secrets.Content[i].Line}
+		if spec := resolveAlias(secrets.Content[i+1]); spec.Kind == yaml.MappingNode {
+			required := mappingValue(spec, "required")
+			secret.Required = required != nil && required.Value == "true"
+		}
+		declared[secrets.Content[i].Value] = secret
+	}
+
+	return declared
+}
+
+// The name of the environment a job runs in, given as `environment: production`, or with a `name` key, when a `url`
+// is given as well.
+func jobEnvironment(job *yaml.Node) string {
+	environment := mappingValue(job, "environment")
+	if environment == nil {
+		return ""
+	} else if environment.Kind == yaml.MappingNode {
+		environment = mappingValue(environment, "name")
+		if environment == nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(environment.Value)
+}
+
+// A name for a step, to show to users.
+func stepName(step *yaml.Node, index int) string {
+	if step.Kind == yaml.MappingNode {
+		for _, key := range []string{"name", "id"} {
+			if value := mappingValue(step, key); value != nil && value.Value != "" {
+				return value.Value
+			}
+		}
+	}
+	return fmt.Sprintf("#%v", index+1)
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolveAlias(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// Collect the references to a context, like `secrets`, in a step. References in the `with` of a step that uses a local
+// action are noted with the input they are passed to, so they can be traced into the action.
+func collectStep(step *yaml.Node, context string, base SecretUsage, add func(namedUsage)) {
+	action := ""
+	if uses := mappingValue(step, "uses"); uses != nil && strings.HasPrefix(uses.Value, "./") {
+		action = strings.TrimSpace(uses.Value)
+	}
+
+	for i := 0; i+1 < len(step.Content); i += 2 {
+		key, value := step.Content[i].Value, resolveAlias(step.Content[i+1])
+
+		if key == "with" && action != "" && value.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				input := value.Content[j].Value
+				walkExpressions(value.Content[j+1], context, false, func(name string, line int) {
+					usage := base
+					usage.Line = line
+					add(namedUsage{Secret: name, SecretUsage: usage, Action: action, Input: input})
+				})
+			}
+			continue
+		}
+
+		walkExpressions(value, context, key == "if", func(name string, line int) {
+			usage := base
+			usage.Line = line
+			add(namedUsage{Secret: name, SecretUsage: usage})
+		})
+	}
+}
+
+// Call `found` for each reference to a context, like `secrets`, in expressions in the given node, and everything under
+// it. Values of `if` keys are expressions even without `${{ }}`, so they are treated as such, as is the node itself if
+// `isExpression` is set.
+func walkExpressions(node *yaml.Node, context string, isExpression bool, found func(name string, line int)) {
+	node = resolveAlias(node)
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		for _, expression := range findExpressions(node.Value, isExpression) {
+			for _, name := range contextReferences(expression.Text, context) {
+				found(name, scalarLine(node, expression.Offset))
+			}
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkExpressions(node.Content[i+1], context, node.Content[i].Value == "if", found)
+		}
+
+	case yaml.SequenceNode, yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkExpressions(child, context, false, found)
+		}
+	}
+}
+
+// The line of the given offset in a scalar's value. Exact for block scalars, like `run: |`, which is where multi-line
+// values usually are.
+func scalarLine(node *yaml.Node, offset int) int {
+	if node.Style&yaml.LiteralStyle != 0 {
+		return node.Line + 1 + strings.Count(node.Value[:offset], "\n")
+	} else if node.Style&yaml.FoldedStyle != 0 {
+		return node.Line + 1
+	}
+	return node.Line
+}
+
+type expression struct {
+	Text   string
+	Offset int // of the expression in the value it was found in.
+}
+
+// The `${{ }}` expressions in a value, or the whole value, if it's an expression already, and has no `${{ }}` in it.
+func findExpressions(value string, isExpression bool) []expression {
+	expressions := []expression{}
+
+	for offset := 0; ; {
+		start := strings.Index(value[offset:], "${{")
+		if start < 0 {
+			break
+		}
+		start += offset
+
+		end := strings.Index(value[start:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start
+
+		expressions = append(expressions, expression{Text: value[start+3 : end], Offset: start})
+		offset = end + 2
+	}
+
+	if isExpression && len(expressions) == 0 {
+		expressions = append(expressions, expression{Text: value})
+	}
+
+	return expressions
+}
+
+// Names used from a context in an expression, like `NAME` from `secrets.NAME` and `secrets['NAME']`, for the `secrets`
+// context. String literals are skipped, so `'secrets.NAME'` doesn't count, and neither does a property with the same
+// name as the context, like in `github.secrets.NAME`.
+func contextReferences(text, context string) []string {
+	names := []string{}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		if c == '\'' {
+			_, i = readStringLiteral(text, i)
+			continue
+		}
+
+		if !isIdentifierStart(c) {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(text) && isIdentifierPart(text[i]) {
+			i++
+		}
+
+		if !strings.EqualFold(text[start:i], context) || precededByDot(text, start) {
+			continue
+		}
+
+		j := skipSpaces(text, i)
+		if j < len(text) && text[j] == '.' {
+			j = skipSpaces(text, j+1)
+			nameStart := j
+			for j < len(text) && isIdentifierPart(text[j]) {
+				j++
+			}
+			if j > nameStart {
+				names = append(names, text[nameStart:j])
+				i = j
+			}
+
+		} else if j < len(text) && text[j] == '[' {
+			j = skipSpaces(text, j+1)
+			if j < len(text) && text[j] == '\'' {
+				name, end := readStringLiteral(text, j)
+				if end = skipSpaces(text, end); end < len(text) && text[end] == ']' && name != "" {
+					names = append(names, name)
+					i = end + 1
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// Read the string literal starting at the given quote, where two quotes in a row are an escaped quote. Returns the
+// string, and the offset just after it.
+func readStringLiteral(text string, start int) (string, int) {
+	value := strings.Builder{}
+	for i := start + 1; i < len(text); i++ {
+		if text[i] != '\'' {
+			value.WriteByte(text[i])
+		} else if i+1 < len(text) && text[i+1] == '\'' {
+			value.WriteByte('\'')
+			i++
+		} else {
+			return value.String(), i + 1
+		}
+	}
+	return value.String(), len(text)
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || c == '-' || (c >= '0' && c <= '9')
+}
+
+func precededByDot(text string, offset int) bool {
+	for offset > 0 && text[offset-1] == ' ' {
+		offset--
+	}
+	return offset > 0 && text[offset-1] == '.'
+}
+
+func skipSpaces(text string, offset int) int {
+	for offset < len(text) && (text[offset] == ' ' || text[offset] == '\t') {
+		offset++
+	}
+	return offset
+}
+
+var secretsPattern = regexp.MustCompile(`\${{[^}]*?\bsecrets\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Find secrets used in a workflow that couldn't be parsed, line by line, skipping lines that are comments.
+func scanWorkflowUsages(filename string, content []byte) []namedUsage {
+	usages := []namedUsage{}
+
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, match := range secretsPattern.FindAllStringSubmatch(line, -1) {
+			usages = append(usages, namedUsage{Secret: match[1], SecretUsage: SecretUsage{File: filename, Line: i + 1}})
+		}
+	}
+
+	return usages
+}
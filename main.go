@@ -9,10 +9,12 @@ import (
 	"github.com/sharat87/gass/github"
 	"github.com/sharat87/gass/parseargs"
 	"golang.org/x/crypto/nacl/box"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var ( // Injected at biuld time.
@@ -21,15 +23,6 @@ var ( // Injected at biuld time.
 	Date    string
 )
 
-// Styles codes from <https://stackoverflow.com/a/33206814/151048>.
-const STYLE_RESET = "\033[0m"
-const STYLE_RED = "\033[31m"
-const STYLE_GREEN = "\033[32m"
-const STYLE_BLUE = "\033[34m"
-const STYLE_MAGENTA = "\033[33m"
-const STYLE_BOLD = "\033[1m"
-const STYLE_REVERSE = "\033[7m"
-
 type SecretValue struct {
 	Type    string
 	Value   string
@@ -38,59 +31,129 @@ type SecretValue struct {
 
 type SecretValueSpec struct {
 	Value            string
-	FromEnv          string
+	FromEnv          string   `yaml:"from_env"`
 	OrgVisibility    string   `yaml:"visibility"`
 	OrgSelectedRepos []string `yaml:"selected_repos"`
+
+	// Metadata, only used by gass itself, and never sent to GitHub.
+	Description string
+	Owner       string
+	Expires     string // a date, like `2022-12-31`.
+	RotateEvery string `yaml:"rotate_every"` // a duration, like `90d`.
 }
 
 type SecretPack struct {
-	Secrets map[string]SecretValueSpec
+	UsePacks []string `yaml:"use_packs"`
+	Secrets  map[string]SecretValueSpec
 }
 
 type SyncSpecRepo struct {
-	Delete  bool `yaml:"delete_unspecified"`
-	Secrets map[string]SecretValueSpec
-	Envs    map[string]SecretPack
+	// Unset when not given, so that merging with selectors can tell it apart from `false`.
+	Delete   *bool    `yaml:"delete_unspecified"`
+	UsePacks []string `yaml:"use_packs"`
+	Secrets  map[string]SecretValueSpec
+	Envs     map[string]SecretPack
+
+	// A local checkout of the repo, to find used secrets in, instead of the workflows on GitHub. Relative to the config
+	// file, once loaded.
+	LocalPath string `yaml:"local_path"`
+}
+
+// Whether secrets not in the spec are to be deleted. Defaults to false when not given.
+func (spec SyncSpecRepo) DeletesUnspecified() bool {
+	return spec.Delete != nil && *spec.Delete
 }
 
 type SyncSpecOrg struct {
-	Delete  bool `yaml:"delete_unspecified"`
-	Secrets map[string]SecretValueSpec
+	Delete   bool     `yaml:"delete_unspecified"`
+	UsePacks []string `yaml:"use_packs"`
+	Secrets  map[string]SecretValueSpec
 }
 
 type SyncSpec struct {
-	Vars  interface{}
-	Repos map[string]SyncSpecRepo
-	Orgs  map[string]SyncSpecOrg
+	Vars          interface{}
+	Packs         map[string]SecretPack
+	Repos         map[string]SyncSpecRepo
+	RepoSelectors []RepoSelector `yaml:"repo_selectors"`
+	Orgs          map[string]SyncSpecOrg
 }
 
 type QualifiedSecretCallsByRepo struct {
-	KeyId        string
-	FullRepoName string
-	Calls        []QualifiedSecretCall
-	UsedSecrets  map[string]map[string]interface{}
-	Envs         map[string]QualifiedSecretCallsByRepoEnv
+	KeyId             string
+	FullRepoName      string
+	Calls             []QualifiedSecretCall
+	UsedSecrets       map[string][]github.SecretUsage
+	Envs              map[string]QualifiedSecretCallsByRepoEnv
+	RemoteFingerprint string // of the repo's secrets on GitHub, as seen when computing the calls.
+
+	// Secrets on GitHub that aren't in the config, and are left alone since `delete` isn't set.
+	UnmanagedSecrets []string
+
+	// Secrets of the repo's org that it can see, as they are on GitHub.
+	OrgSecrets []string
+
+	// The repo on GitHub, with its id and visibility, to tell which of its org's secrets it can see once the plan is
+	// applied. Only set when the plan creates or updates org secrets that only some repos can see.
+	Repo github.Repo
+
+	// Secrets of envs on GitHub that aren't in the config, by env name, for envs that jobs using secrets run in.
+	OtherEnvSecrets map[string][]string
+
+	// Repo level secrets were skipped due to filters, and only envs were considered.
+	SkippedRepoSecrets bool
 }
 
 type QualifiedSecretCallsByRepoEnv struct {
-	Calls       []QualifiedSecretCall
-	UsedSecrets map[string]map[string]interface{}
+	Calls             []QualifiedSecretCall
+	UsedSecrets       map[string][]github.SecretUsage
+	RemoteFingerprint string
+	UnmanagedSecrets  []string
 }
 
 type QualifiedSecretCallsByOrg struct {
 	KeyId   string
 	OrgName string
 	Calls   []QualifiedSecretCall
-	// TODO: We aren't inspecting used secrets in orgs yet.
-	UsedSecrets map[string]map[string]interface{}
+	// Only of secrets being deleted, or made visible to fewer repos, with the repo of each usage.
+	UsedSecrets       map[string][]github.SecretUsage
+	RemoteFingerprint string
+	UnmanagedSecrets  []string
 }
 
 type QualifiedSecretCall struct {
-	Call           string // "create", "update", or "delete".
+	Call           string // "create", "update", "unchanged", or "delete".
 	SecretName     string
 	EncryptedValue string // empty if `Call` is "delete".
+	ValueHmac      string // HMAC of the value for the state file, empty if there's no state file.
 	OrgVisibility  string // "org", "private", or "selected".
 	OrgRepoIds     []int  // only applicable if `OrgVisibility` is "selected".
+	FromPack       string // name of the pack this secret came from, empty if specified directly.
+	Warnings       []string
+}
+
+// The outcome of a single call made to GitHub, when applying changes.
+type AppliedCall struct {
+	TargetType string // "repo" or "org".
+	Target     string
+	EnvName    string // empty if not an env secret.
+	Call       QualifiedSecretCall
+	StatusCode int // HTTP status of the response, zero if there wasn't one.
+	Err        error
+}
+
+// Settings that apply to computing calls for all repos and orgs.
+type ComputeOptions struct {
+	Packs        map[string]SecretPack
+	ExpiryWindow time.Duration
+	State        *State // nil if no state file is used.
+	Filter       Filter
+	IsDry        bool
+
+	// Where to find used secrets, for all repos. A local checkout, if given, else the workflows on GitHub at the ref.
+	WorkflowsFrom string
+	WorkflowsRef  string
+
+	UsageCache UsageCache // nil to not cache used secrets.
 }
 
 func (sv SecretValue) GetRealizedValue() (string, error) {
@@ -111,211 +174,497 @@ func (sv SecretValueSpec) GetRealizedValue() (string, error) {
 	return "", errors.New("Both `Value` and `FromEnv` were provided in SecretValueSpec")
 }
 
+// Merge the secrets from the given packs, in order, with the given local secrets. Later packs override earlier ones, and
+// local secrets override all packs. The second return value maps secret names to the pack they came from, for secrets
+// that aren't specified locally.
+func resolveSecrets(packs map[string]SecretPack, usePacks []string, secrets map[string]SecretValueSpec) (map[string]SecretValueSpec, map[string]string, error) {
+	resolved := map[string]SecretValueSpec{}
+	fromPacks := map[string]string{}
+
+	for _, packName := range usePacks {
+		pack, ok := packs[packName]
+		if !ok {
+			return nil, nil, &ConfigError{fmt.Sprintf("Unknown pack '%v' in `use_packs`", packName)}
+		}
+
+		for name, valueSpec := range pack.Secrets {
+			resolved[name] = valueSpec
+			fromPacks[name] = packName
+		}
+	}
+
+	for name, valueSpec := range secrets {
+		resolved[name] = valueSpec
+		delete(fromPacks, name)
+	}
+
+	return resolved, fromPacks, nil
+}
+
 func main() {
-	ia := parseargs.ParseArgs(os.Args[1:])
+	ia, err := parseargs.ParseArgs(os.Args[1:])
+	if err != nil {
+		exitWith(EXIT_ERROR, err.Error()+". Run `gass help` for usage.")
+	}
 
-	fmt.Printf("gass version:%v commit:%v built:%v\n", Version, Commit, Date)
+	if ia.Action == "help" {
+		fmt.Print(parseargs.Help(ia.HelpFor))
+		return
+	}
 
-	if ia.Files == nil {
-		log.Println("Please specify at least one `--file`.")
+	if ia.Action == "completion" {
+		fmt.Print(parseargs.CompletionScript(ia.Shell))
+		return
+	}
+
+	if ia.Action == "__complete" {
+		for _, completion := range parseargs.Complete(ia.CompleteArgs, completionValues) {
+			fmt.Println(completion)
+		}
+		return
+	}
+
+	if err := setupOutput(ia.Output, ia.NoColor); err != nil {
+		exitWith(EXIT_ERROR, err)
+	}
+	actionsOutput = newActionsOutput(statusOut, ia.ForceDeleteUsed)
+	defer flushOutputs()
+
+	fmt.Fprintf(textOut, "gass version:%v commit:%v built:%v\n", Version, Commit, Date)
+
+	if !ia.NoCache {
+		// Without a cache dir, like when `HOME` isn't set, workflows are just fetched every time.
+		if cacheDir, err := os.UserCacheDir(); err == nil {
+			github.CacheDir = filepath.Join(cacheDir, "gass")
+		}
+	}
+
+	github.ReportProblem = func(problem string) {
+		log.Printf("Warning: %v", problem)
+	}
+
+	if ia.Action == "version" {
+		return
+	}
+
+	if ia.Action == "apply" {
+		applyPlanFile(ia)
 		return
 	}
 
+	if ia.Action == "explain" {
+		explainSecret(ia)
+		return
+	}
+
+	if ia.Files == nil {
+		exitWith(EXIT_CONFIG_INVALID, "Please specify at least one `--file`.")
+	}
+
 	if ia.IsDry {
-		fmt.Print("\n" + STYLE_RED + "***    Dry run    ***" + STYLE_RESET + "\n\n")
+		fmt.Fprint(textOut, "\n"+style.Red("***    Dry run    ***")+"\n\n")
 	}
 
 	allChanges := []QualifiedSecretCallsByRepo{}
 	allChangesForOrgs := []QualifiedSecretCallsByOrg{}
 
-	haveErrors := false
+	// The exit code for errors found so far, if any. Config errors win over others, since they're the ones to fix first.
+	errorCode := EXIT_OK
+	noteError := func(code int) {
+		if errorCode == EXIT_OK || code == EXIT_CONFIG_INVALID {
+			errorCode = code
+		}
+	}
+
+	// Packs are collected from all files first, so that a repo in one file can use a pack defined in another.
+	secretsConfigs := []SyncSpec{}
+	configFiles := []string{} // name of the file each of `secretsConfigs` was loaded from.
+	packs := map[string]SecretPack{}
 
 	for _, file := range ia.Files {
-		secretsConfig := loadYaml(file)
+		secretsConfig, content, err := loadConfig(file, ia.Format)
+		if err != nil {
+			noteError(EXIT_CONFIG_INVALID)
+			log.Printf("Error loading config file '%v', due to '%v'", file, err)
+			continue
+		}
+		secretsConfigs = append(secretsConfigs, secretsConfig)
+		configFiles = append(configFiles, file)
+		actionsOutput.AddConfig(file, content)
+
+		for name, pack := range secretsConfig.Packs {
+			if _, ok := packs[name]; ok {
+				noteError(EXIT_CONFIG_INVALID)
+				log.Printf("Pack '%v' is defined more than once", name)
+				continue
+			}
+			if pack.UsePacks != nil {
+				noteError(EXIT_CONFIG_INVALID)
+				log.Printf("Pack '%v' can't use other packs", name)
+				continue
+			}
+			packs[name] = pack
+		}
+	}
+
+	expiryWindow := DEFAULT_EXPIRY_WINDOW
+	if ia.ExpiryWindow != "" {
+		var err error
+		expiryWindow, err = parseDuration(ia.ExpiryWindow)
+		if err != nil {
+			exitWithf(EXIT_ERROR, "Invalid `--expiry-window` '%v': %v", ia.ExpiryWindow, err)
+		}
+	}
+
+	if ia.Action == "validate" {
+		if errorCode != EXIT_OK {
+			exitWith(errorCode, "Errors detected. Please rectify and retry.")
+		}
+		problems := []string{}
+		for _, secretsConfig := range secretsConfigs {
+			problems = append(problems, validateConfig(secretsConfig, packs, time.Now())...)
+		}
+		for _, problem := range problems {
+			fmt.Fprintln(textOut, style.Red(problem))
+		}
+		if len(problems) > 0 {
+			exitWith(EXIT_CONFIG_INVALID, "Errors detected. Please rectify and retry.")
+		}
+		fmt.Fprintln(textOut, "No errors found in config files.")
+		return
+	}
+
+	if ia.Action == "report" {
+		if errorCode != EXIT_OK {
+			exitWith(errorCode, "Errors detected. Please rectify and retry.")
+		}
+		printReport(secretsConfigs, time.Now(), expiryWindow)
+		return
+	}
+
+	computeOptions := ComputeOptions{
+		Packs:        packs,
+		ExpiryWindow: expiryWindow,
+		Filter: Filter{
+			Repos:   ia.Repos,
+			Orgs:    ia.Orgs,
+			Envs:    ia.Envs,
+			Secrets: ia.Secrets,
+		},
+		IsDry:         ia.IsDry,
+		WorkflowsFrom: ia.WorkflowsFrom,
+		WorkflowsRef:  ia.WorkflowsRef,
+		UsageCache:    UsageCache{},
+	}
+
+	if err := computeOptions.Filter.Validate(); err != nil {
+		exitWith(EXIT_ERROR, err)
+	}
+
+	if ia.WorkflowsFrom != "" && ia.WorkflowsRef != "" {
+		exitWith(EXIT_ERROR, "Only one of `--workflows-from` and `--workflows-ref` can be given.")
+	}
+
+	if ia.StateFile != "" {
+		var err error
+		computeOptions.State, err = loadState(ia.StateFile)
+		if err != nil {
+			exitWithf(EXIT_ERROR, "Error loading state file '%v': %v", ia.StateFile, err)
+		}
+	}
+
+	// Repo listings of orgs, shared by all selectors on the same org.
+	orgReposCache := map[string][]github.Repo{}
+	fetchOrgRepos := func(org string) ([]github.Repo, error) {
+		if repos, ok := orgReposCache[org]; ok {
+			return repos, nil
+		}
+		repos, err := github.FetchOrgRepos(org)
+		if err == nil {
+			orgReposCache[org] = repos
+		}
+		return repos, err
+	}
+
+	workflowsFromRepo := "" // the repo that `--workflows-from` is used for.
+
+	for configIndex, secretsConfig := range secretsConfigs {
+		repos, matchesBySelector, err := expandRepoSelectors(secretsConfig.RepoSelectors, secretsConfig.Repos, packs, fetchOrgRepos)
+		if err != nil {
+			noteError(exitCodeForError(err))
+			log.Printf("Error resolving repo selectors, due to '%v'", err)
+			continue
+		}
+
+		for i, selector := range secretsConfig.RepoSelectors {
+			fmt.Fprintln(textOut, style.Bold("selector "+selector.String()))
+			if len(matchesBySelector[i]) == 0 {
+				fmt.Fprintln(textOut, "\t"+style.Yellow("matched no repos"))
+			}
+			for _, fullName := range matchesBySelector[i] {
+				fmt.Fprintln(textOut, "\tmatched\t"+fullName)
+				actionsOutput.AddSelectorMatch(configFiles[configIndex], i, fullName)
+			}
+			fmt.Fprintln(textOut, "")
+		}
+
+		for repoName, repo := range repos {
+			if !computeOptions.Filter.IncludesRepo(repoName) {
+				continue
+			}
+
+			// A checkout has the workflows of just one repo, so using it for others would be wrong about their usage.
+			if computeOptions.WorkflowsFrom != "" {
+				if workflowsFromRepo != "" && workflowsFromRepo != repoName {
+					exitWith(EXIT_ERROR, "`--workflows-from` can only be used with a single repo. Use `--repo` to pick one.")
+				}
+				workflowsFromRepo = repoName
+			}
 
-		for repoName, repo := range secretsConfig.Repos {
 			publicKey, err := github.FetchPublicKey(repoName)
 			if err != nil {
-				haveErrors = true
+				noteError(EXIT_API_ERROR)
 				log.Printf("Error getting public-key for repo '%v', due to '%v'", repoName, err)
 				continue
 			}
-			thisRepoChanges := computeCalls(repoName, repo, publicKey, ia.IsDry)
+			thisRepoChanges, err := computeCalls(repoName, repo, publicKey, computeOptions)
+			if err != nil {
+				noteError(exitCodeForError(err))
+				log.Printf("Error computing changes for repo '%v', due to '%v'", repoName, err)
+				continue
+			}
 			thisRepoChanges.KeyId = publicKey.KeyId
-			thisRepoChanges.UsedSecrets, _ = github.FetchUsedSecrets(repoName)
+			usedSecrets, err := fetchUsedSecrets(repoName, repo, computeOptions)
+			if err != nil {
+				// Without knowing the used secrets, we can't tell if a deletion is safe.
+				noteError(EXIT_API_ERROR)
+				log.Printf("Error getting used secrets for repo '%v', due to '%v'", repoName, err)
+				continue
+			}
+			// The cached map is shared, so the filtered secrets go into a new one.
+			thisRepoChanges.UsedSecrets = map[string][]github.SecretUsage{}
+			for name, usages := range usedSecrets {
+				if computeOptions.Filter.IncludesSecret(name) {
+					thisRepoChanges.UsedSecrets[name] = usages
+				}
+			}
+			for envName, env := range thisRepoChanges.Envs {
+				env.UsedSecrets = usagesInEnv(thisRepoChanges.UsedSecrets, envName)
+				thisRepoChanges.Envs[envName] = env
+			}
+			thisRepoChanges.OtherEnvSecrets, err = fetchOtherEnvSecrets(*thisRepoChanges, github.FetchRepoEnvironments, getSecretListForEnv)
+			if err != nil {
+				noteError(EXIT_API_ERROR)
+				log.Printf("Error getting secrets of envs for repo '%v', due to '%v'", repoName, err)
+				continue
+			}
 			allChanges = append(allChanges, *thisRepoChanges)
 		}
 
 		for name, org := range secretsConfig.Orgs {
+			if !computeOptions.Filter.IncludesOrg(name) {
+				continue
+			}
+
 			publicKey, err := github.FetchPublicKeyForOrg(name)
 			if err != nil {
-				haveErrors = true
+				noteError(EXIT_API_ERROR)
 				log.Printf("Error getting public-key for org '%v', due to '%v'", name, err)
 				continue
 			}
-			thisOrgChanges := computeCallsForOrg(name, org, publicKey, ia.IsDry)
+			thisOrgChanges, err := computeCallsForOrg(name, org, publicKey, computeOptions)
+			if err != nil {
+				noteError(exitCodeForError(err))
+				log.Printf("Error computing changes for org '%v', due to '%v'", name, err)
+				continue
+			}
 			thisOrgChanges.KeyId = publicKey.KeyId
-			// thisOrgChanges.UsedSecrets, _ = github.FetchUsedSecrets(org.Name)
+			err = findOrgUsedSecrets(thisOrgChanges, ia.Action == "audit", orgUsageSources{
+				Secrets:       github.FetchOrgSecrets,
+				SelectedRepos: github.FetchSelectedReposForOrgSecret,
+				Repos:         fetchOrgRepos,
+				UsedSecrets: func(repoName string) (map[string][]github.SecretUsage, error) {
+					return fetchOrgRepoUsedSecrets(repoName, computeOptions)
+				},
+			})
+			if err != nil {
+				// Without knowing the used secrets, we can't tell if a deletion is safe.
+				noteError(EXIT_API_ERROR)
+				log.Printf("Error getting used secrets for org '%v', due to '%v'", name, err)
+				continue
+			}
 			allChangesForOrgs = append(allChangesForOrgs, *thisOrgChanges)
 		}
 	}
 
-	if haveErrors {
-		log.Fatalln("Errors detected. Not doing anything. Please rectify and retry.")
+	if err := fillOrgRepos(allChanges, allChangesForOrgs, fetchOrgRepos); err != nil {
+		noteError(EXIT_API_ERROR)
+		log.Printf("Error getting repos of orgs, due to '%v'", err)
 	}
 
-	// Also find used secrets that aren't set on the repo, and aren't given in the yml file here either.
-	isUsedSecretsSetForDeletion := 0
-
-	for _, org := range allChangesForOrgs {
-		fmt.Println(STYLE_BOLD + "org  " + org.OrgName + STYLE_RESET)
-
-		specifiedSecrets := map[string]interface{}{}
+	if errorCode != EXIT_OK {
+		exitWith(errorCode, "Errors detected. Not doing anything. Please rectify and retry.")
+	}
 
-		for _, call := range org.Calls {
-			if call.Call == "delete" {
-				msg := "\t" + STYLE_RED + "deleted\t" + call.SecretName
-
-				if _, ok := org.UsedSecrets[call.SecretName]; ok {
-					isUsedSecretsSetForDeletion += 1
-					msg += STYLE_BOLD + " " + STYLE_REVERSE + "(used in "
-					isFirst := true
-					for file, _ := range org.UsedSecrets[call.SecretName] {
-						msg += "'" + file + "'"
-						if !isFirst {
-							msg += ", "
-						}
-						isFirst = false
-					}
-					msg += ")"
-				}
+	if ia.Action == "audit" {
+		reportAudit(allChanges, allChangesForOrgs)
+		return
+	}
 
-				fmt.Println(msg + STYLE_RESET)
+	plan := reportPlan(allChanges, allChangesForOrgs, ia.Unused)
 
-			} else if call.Call == "create" {
-				// TODO: Check if this is an unused secret, and if yes, show a info message.
-				fmt.Println("\t" + STYLE_GREEN + "created\t" + call.SecretName + STYLE_RESET)
-				specifiedSecrets[call.SecretName] = nil
+	checkUsedSecretsSetForDeletion(plan.UsedDeletions(), ia.ForceDeleteUsed)
 
-			} else if call.Call == "update" {
-				// TODO: Check if this is an unused secret, and if yes, show a info message.
-				fmt.Println("\t" + STYLE_BLUE + "updated\t" + call.SecretName + STYLE_RESET)
-				specifiedSecrets[call.SecretName] = nil
+	if count := plan.UnusedSecrets(); count > 0 && ia.Unused == "error" {
+		exitWithf(EXIT_CONFIG_INVALID, "%v secrets in the config aren't used by any workflow. Not doing anything. Please remove them and retry, or use `--unused warn`.", count)
+	}
 
+	if ia.Action == "plan" {
+		if ia.PlanOut != "" {
+			if err := savePlanFile(ia.PlanOut, allChanges, allChangesForOrgs); err != nil {
+				exitWithf(EXIT_ERROR, "Error saving plan file '%v': %v", ia.PlanOut, err)
 			}
+			fmt.Fprintln(textOut, "Plan saved to '"+ia.PlanOut+"'. Apply it with `gass apply "+ia.PlanOut+"`.")
 		}
+		exitIfChanges(ia.DetailedExitCode, allChanges, allChangesForOrgs)
+		return
+	}
 
-		for usedSecret, _ := range org.UsedSecrets {
-			if _, ok := specifiedSecrets[usedSecret]; !ok {
-				fmt.Println("\t" + STYLE_MAGENTA + "missing\t" + usedSecret + STYLE_RESET)
-			}
-		}
+	// TODO: Before applying anything, ensure all required things exist, like repos, orgs, envs etc.
+	if ia.IsDry {
+		fmt.Fprintln(textOut, style.Red("Not applying anything, since this is a dry run."))
+		exitIfChanges(ia.DetailedExitCode, allChanges, allChangesForOrgs)
+	} else {
+		applyAndSaveState(allChanges, allChangesForOrgs, computeOptions.State, ia)
+	}
+}
 
-		fmt.Println("")
+// Apply a plan saved earlier with `gass plan --out`, if the secrets and public keys on GitHub haven't changed since.
+func applyPlanFile(ia parseargs.InvokeArgs) {
+	if ia.PlanFile == "" {
+		exitWith(EXIT_ERROR, "Please specify the plan file to apply, like `gass apply plan.json`.")
 	}
 
-	for _, repo := range allChanges {
-		fmt.Println(STYLE_BOLD + "repo " + repo.FullRepoName + STYLE_RESET)
+	plan, err := loadPlanFile(ia.PlanFile)
+	if err != nil {
+		exitWithf(EXIT_ERROR, "Error loading plan file '%v': %v", ia.PlanFile, err)
+	}
 
-		specifiedSecrets := map[string]interface{}{}
+	changedTargets, err := verifyPlanFile(plan)
+	if err != nil {
+		exitWithf(EXIT_API_ERROR, "Error checking current state on GitHub: %v", err)
+	}
 
-		for _, call := range repo.Calls {
-			if call.Call == "delete" {
-				msg := "\t" + STYLE_RED + "deleted\t" + call.SecretName
-
-				if _, ok := repo.UsedSecrets[call.SecretName]; ok {
-					isUsedSecretsSetForDeletion += 1
-					msg += STYLE_BOLD + " " + STYLE_REVERSE + "(used in "
-					isFirst := true
-					for file, _ := range repo.UsedSecrets[call.SecretName] {
-						msg += "'" + file + "'"
-						if !isFirst {
-							msg += ", "
-						}
-						isFirst = false
-					}
-					msg += ")"
-				}
+	if len(changedTargets) > 0 {
+		for _, target := range changedTargets {
+			fmt.Fprintln(textOut, style.Red("changed since planning: "+target))
+		}
+		exitWith(EXIT_ERROR, "Secrets or public keys on GitHub have changed since the plan was made. Not applying anything. Please plan again.")
+	}
 
-				fmt.Println(msg + STYLE_RESET)
+	var state *State
+	if ia.StateFile != "" {
+		state, err = loadState(ia.StateFile)
+		if err != nil {
+			exitWithf(EXIT_ERROR, "Error loading state file '%v': %v", ia.StateFile, err)
+		}
+	}
 
-			} else if call.Call == "create" {
-				// TODO: Check if this is an unused secret, and if yes, show a info message.
-				fmt.Println("\t" + STYLE_GREEN + "created\t" + call.SecretName + STYLE_RESET)
-				specifiedSecrets[call.SecretName] = nil
+	reportedPlan := reportPlan(plan.Repos, plan.Orgs, "")
 
-			} else if call.Call == "update" {
-				// TODO: Check if this is an unused secret, and if yes, show a info message.
-				fmt.Println("\t" + STYLE_BLUE + "updated\t" + call.SecretName + STYLE_RESET)
-				specifiedSecrets[call.SecretName] = nil
+	checkUsedSecretsSetForDeletion(reportedPlan.UsedDeletions(), ia.ForceDeleteUsed)
 
-			}
-		}
+	applyAndSaveState(plan.Repos, plan.Orgs, state, ia)
+}
 
-		for usedSecret, _ := range repo.UsedSecrets {
-			if _, ok := specifiedSecrets[usedSecret]; !ok {
-				fmt.Println("\t" + STYLE_MAGENTA + "missing\t" + usedSecret + STYLE_RESET)
-			}
-		}
+// Exit, unless forced, if any secrets used in workflows are set for deletion.
+func checkUsedSecretsSetForDeletion(count int, isForced bool) {
+	if count == 0 {
+		return
+	}
 
-		for envName, envChanges := range repo.Envs {
-			fmt.Println("\t" + STYLE_BOLD + "env " + envName + STYLE_RESET)
-			for _, call := range envChanges.Calls {
-				if call.Call == "delete" {
-					msg := "\t\t" + STYLE_RED + "deleted\t" + call.SecretName
-
-					if _, ok := repo.UsedSecrets[call.SecretName]; ok {
-						isUsedSecretsSetForDeletion += 1
-						msg += STYLE_BOLD + " " + STYLE_REVERSE + "(used in "
-						isFirst := true
-						for file, _ := range repo.UsedSecrets[call.SecretName] {
-							msg += "'" + file + "'"
-							if !isFirst {
-								msg += ", "
-							}
-							isFirst = false
-						}
-						msg += ")"
-					}
+	if isForced {
+		fmt.Fprintln(
+			textOut,
+			style.Red("Some secrets that are used in workflows are set for deletion. Continuing anyway, since `--force-delete-used` was given."),
+		)
+		return
+	}
 
-					fmt.Println(msg + STYLE_RESET)
+	fmt.Fprintln(
+		textOut,
+		style.Red("Some secrets that are used in workflows are set for deletion. Exiting without doing anything. Please review above output, resolve this and run again, or use `--force-delete-used`."),
+	)
+	flushOutputs()
+	osExit(EXIT_ERROR)
+}
 
-				} else if call.Call == "create" {
-					// TODO: Check if this is an unused secret, and if yes, show a info message.
-					fmt.Println("\t\t" + STYLE_GREEN + "created\t" + call.SecretName + STYLE_RESET)
-					specifiedSecrets[call.SecretName] = nil
+// Exit with `EXIT_CHANGES` if there are any changes, and a detailed exit code is asked for. Used when the changes
+// aren't being applied, so CI can tell if there's something to apply.
+func exitIfChanges(isDetailed bool, allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg) {
+	if !isDetailed {
+		return
+	}
 
-				} else if call.Call == "update" {
-					// TODO: Check if this is an unused secret, and if yes, show a info message.
-					fmt.Println("\t\t" + STYLE_BLUE + "updated\t" + call.SecretName + STYLE_RESET)
-					specifiedSecrets[call.SecretName] = nil
+	summary, _ := summarizeChanges(allChanges, allChangesForOrgs, 0)
+	if summary.Total() > 0 {
+		flushOutputs()
+		osExit(EXIT_CHANGES)
+	}
+}
 
-				}
-			}
+// Apply the changes, after confirmation if running interactively, and record them in the state file, if any.
+func applyAndSaveState(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg, state *State, ia parseargs.InvokeArgs) {
+	deleteThreshold := DEFAULT_DELETE_CONFIRM_THRESHOLD
+	if ia.DeleteConfirmThreshold != "" {
+		var err error
+		deleteThreshold, err = strconv.Atoi(ia.DeleteConfirmThreshold)
+		if err != nil {
+			exitWithf(EXIT_ERROR, "Invalid `--delete-confirm-threshold` '%v': %v", ia.DeleteConfirmThreshold, err)
 		}
+	}
 
-		fmt.Println("")
+	summary, manyDeletes := summarizeChanges(allChanges, allChangesForOrgs, deleteThreshold)
+	if summary.Total() == 0 {
+		fmt.Fprintln(textOut, "No changes to apply.")
+		return
 	}
 
-	if isUsedSecretsSetForDeletion > 0 {
-		fmt.Println(
-			STYLE_RED + "Some secrets that are used in workflows are set for deletion. Exiting without doing anything. Please review above output, resolve this and run again." + STYLE_RESET,
-		)
+	// Only ask when there's someone to answer, so CI runs aren't stuck waiting.
+	if !ia.Yes && isTerminal(os.Stdin) {
+		if !confirmApply(summary, manyDeletes, os.Stdin, statusOut) {
+			fmt.Fprintln(statusOut, style.Red("Not confirmed. Exiting without doing anything."))
+			flushOutputs()
+			osExit(EXIT_ERROR)
+		}
 	}
 
-	// TODO: Before applying anything, ensure all required things exist, like repos, orgs, envs etc.
-	if ia.IsDry {
-		fmt.Println(STYLE_RED + "Not applying anything, since this is a dry run." + STYLE_RESET)
-	} else {
-		applyChanges(allChanges, allChangesForOrgs)
+	results := applyChanges(allChanges, allChangesForOrgs)
+	reportResults(results)
+
+	if state != nil {
+		updateState(state, results)
+		if err := state.Save(ia.StateFile); err != nil {
+			exitWithf(EXIT_ERROR, "Error saving state file '%v': %v", ia.StateFile, err)
+		}
+	}
+
+	// The state is saved first, so the changes that did succeed aren't pushed again on the next run.
+	for _, result := range results {
+		if result.Err != nil {
+			exitWith(EXIT_PARTIAL_APPLY, "Some changes couldn't be applied. Please see the errors above.")
+		}
 	}
 }
 
-func applyChanges(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg) {
+func applyChanges(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg) []AppliedCall {
+	results := []AppliedCall{}
+
 	for _, orgChanges := range allChangesForOrgs {
 		for _, call := range orgChanges.Calls {
 			if call.Call == "delete" {
-				err := github.DeleteSecretForOrg(orgChanges.OrgName, call.SecretName)
+				status, err := github.DeleteSecretForOrg(orgChanges.OrgName, call.SecretName)
+				results = append(results, AppliedCall{TargetType: "org", Target: orgChanges.OrgName, Call: call, StatusCode: status, Err: err})
 				if err != nil {
 					log.Printf("Error deleting secret on GitHub %v/%v: %v", orgChanges.OrgName, call.SecretName, err)
 					continue
@@ -323,7 +672,8 @@ func applyChanges(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []Q
 
 			} else if call.Call == "create" || call.Call == "update" {
 				log.Printf("repo ids %v", call.OrgRepoIds)
-				err := github.PutSecretForOrg(orgChanges.OrgName, call.SecretName, orgChanges.KeyId, call.EncryptedValue, call.OrgVisibility, call.OrgRepoIds)
+				status, err := github.PutSecretForOrg(orgChanges.OrgName, call.SecretName, orgChanges.KeyId, call.EncryptedValue, call.OrgVisibility, call.OrgRepoIds)
+				results = append(results, AppliedCall{TargetType: "org", Target: orgChanges.OrgName, Call: call, StatusCode: status, Err: err})
 				if err != nil {
 					log.Printf("Error putting secret to GitHub %v/%v: %v", orgChanges.OrgName, call.SecretName, err)
 					continue
@@ -336,14 +686,16 @@ func applyChanges(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []Q
 	for _, repoChanges := range allChanges {
 		for _, call := range repoChanges.Calls {
 			if call.Call == "delete" {
-				err := github.DeleteSecret(repoChanges.FullRepoName, call.SecretName)
+				status, err := github.DeleteSecret(repoChanges.FullRepoName, call.SecretName)
+				results = append(results, AppliedCall{TargetType: "repo", Target: repoChanges.FullRepoName, Call: call, StatusCode: status, Err: err})
 				if err != nil {
 					log.Printf("Error deleting secret on GitHub %v/%v: %v", repoChanges.FullRepoName, call.SecretName, err)
 					continue
 				}
 
 			} else if call.Call == "create" || call.Call == "update" {
-				err := github.PutSecret(repoChanges.FullRepoName, call.SecretName, repoChanges.KeyId, call.EncryptedValue)
+				status, err := github.PutSecret(repoChanges.FullRepoName, call.SecretName, repoChanges.KeyId, call.EncryptedValue)
+				results = append(results, AppliedCall{TargetType: "repo", Target: repoChanges.FullRepoName, Call: call, StatusCode: status, Err: err})
 				if err != nil {
 					log.Printf("Error putting secret to GitHub %v/%v: %v", repoChanges.FullRepoName, call.SecretName, err)
 					continue
@@ -355,14 +707,16 @@ func applyChanges(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []Q
 		for envName, envChanges := range repoChanges.Envs {
 			for _, call := range envChanges.Calls {
 				if call.Call == "delete" {
-					err := github.DeleteSecretForEnv(repoChanges.FullRepoName, envName, call.SecretName)
+					status, err := github.DeleteSecretForEnv(repoChanges.FullRepoName, envName, call.SecretName)
+					results = append(results, AppliedCall{TargetType: "repo", Target: repoChanges.FullRepoName, EnvName: envName, Call: call, StatusCode: status, Err: err})
 					if err != nil {
 						log.Printf("Error deleting env secret on GitHub %v/%v/%v: %v", repoChanges.FullRepoName, envName, call.SecretName, err)
 						continue
 					}
 
 				} else if call.Call == "create" || call.Call == "update" {
-					err := github.PutSecretForEnv(repoChanges.FullRepoName, envName, call.SecretName, repoChanges.KeyId, call.EncryptedValue)
+					status, err := github.PutSecretForEnv(repoChanges.FullRepoName, envName, call.SecretName, repoChanges.KeyId, call.EncryptedValue)
+					results = append(results, AppliedCall{TargetType: "repo", Target: repoChanges.FullRepoName, EnvName: envName, Call: call, StatusCode: status, Err: err})
 					if err != nil {
 						log.Printf("Error putting env secret to GitHub %v/%v/%v: %v", repoChanges.FullRepoName, envName, call.SecretName, err)
 						continue
@@ -372,144 +726,242 @@ func applyChanges(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []Q
 			}
 		}
 	}
+
+	return results
 }
 
-func computeCalls(fullRepoName string, spec SyncSpecRepo, publicKey github.PublicKey, isDry bool) *QualifiedSecretCallsByRepo {
+func computeCalls(fullRepoName string, spec SyncSpecRepo, publicKey github.PublicKey, opts ComputeOptions) (*QualifiedSecretCallsByRepo, error) {
 	changes := &QualifiedSecretCallsByRepo{
 		KeyId:        publicKey.KeyId,
 		FullRepoName: fullRepoName,
 		Calls:        []QualifiedSecretCall{},
+
+		SkippedRepoSecrets: !opts.Filter.IncludesRepoSecrets(),
 	}
 
 	if spec.Envs != nil {
 		changes.Envs = map[string]QualifiedSecretCallsByRepoEnv{}
 	}
 
+	existingSecrets, err := getSecretList(fullRepoName)
+	if err != nil {
+		return nil, err
+	}
+
+	changes.RemoteFingerprint = fingerprintRemote(publicKey.KeyId, existingSecrets)
+
+	orgSecrets, err := getOrgSecretListForRepo(fullRepoName)
+	if err != nil {
+		return nil, err
+	}
+	changes.OrgSecrets = sortedKeys(orgSecrets)
+
 	existingSecretNames := map[string]interface{}{}
 
-	for _, name := range getSecretList(fullRepoName) {
+	for name := range existingSecrets {
 		existingSecretNames[name] = nil
 	}
 
-	for name, valueSpec := range spec.Secrets {
+	secrets, fromPacks, err := resolveSecrets(opts.Packs, spec.UsePacks, spec.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	secretErrors := []string{}
+
+	for name, valueSpec := range secrets {
+		if !opts.Filter.IncludesRepoSecrets() || !opts.Filter.IncludesSecret(name) {
+			continue
+		}
+
+		warnings, err := checkExpiry(valueSpec, time.Now(), opts.ExpiryWindow)
+		if err != nil {
+			secretErrors = append(secretErrors, name+": "+err.Error())
+			continue
+		}
+
 		stringValue, err := valueSpec.GetRealizedValue()
+		actionsOutput.Mask(stringValue)
 		if err != nil {
-			log.Printf("Error getting realized value %v/%v: %v", fullRepoName, name, err)
+			secretErrors = append(secretErrors, name+": error getting value: "+err.Error())
 			continue
 		}
 
 		encryptedValue, err := encrypt(publicKey.Key, stringValue)
 		if err != nil {
-			log.Printf("Error encrypting value for secret %v/%v: %v", fullRepoName, name, err)
+			secretErrors = append(secretErrors, name+": error encrypting value: "+err.Error())
 			continue
 		}
 
-		call := "create"
-		if _, ok := existingSecretNames[name]; ok {
-			call = "update"
-		}
+		valueHmac := opts.State.Hmac(stringValue)
+		call, driftWarnings := classifyCall(opts.State, stateKeyForRepo(fullRepoName), name, valueHmac, existingSecrets)
 
 		changes.Calls = append(changes.Calls, QualifiedSecretCall{
 			Call:           call,
 			SecretName:     name,
 			EncryptedValue: encryptedValue,
+			ValueHmac:      valueHmac,
+			FromPack:       fromPacks[name],
+			Warnings:       append(append(warnings, driftWarnings...), rotationWarnings(valueSpec, call, existingSecrets[name], time.Now())...),
 		})
 
-		if spec.Delete {
-			delete(existingSecretNames, name)
-		}
+		delete(existingSecretNames, name)
 	}
 
-	if spec.Delete {
+	if spec.DeletesUnspecified() && opts.Filter.IncludesRepoSecrets() {
 		for name, _ := range existingSecretNames {
+			// Deletions are filtered too, so that a targeted run never deletes unrelated secrets.
+			if !opts.Filter.IncludesSecret(name) {
+				continue
+			}
 			changes.Calls = append(changes.Calls, QualifiedSecretCall{
 				Call:       "delete",
 				SecretName: name,
 			})
 		}
+	} else if opts.Filter.IncludesRepoSecrets() {
+		changes.UnmanagedSecrets = unmanagedNames(existingSecretNames, opts.Filter)
 	}
 
 	for envName, secretPack := range spec.Envs {
+		if !opts.Filter.IncludesEnv(envName) {
+			continue
+		}
+
+		existingSecretsForEnv, err := getSecretListForEnv(fullRepoName, envName)
+		if err != nil {
+			return nil, fmt.Errorf("env '%v': %w", envName, err)
+		}
+
 		envChanges := QualifiedSecretCallsByRepoEnv{
-			Calls: []QualifiedSecretCall{},
+			Calls:             []QualifiedSecretCall{},
+			RemoteFingerprint: fingerprintRemote(publicKey.KeyId, existingSecretsForEnv),
 		}
 
 		existingSecretNamesForEnv := map[string]interface{}{}
 
-		for _, name := range getSecretListForEnv(fullRepoName, envName) {
+		for name := range existingSecretsForEnv {
 			existingSecretNamesForEnv[name] = nil
 		}
 
-		for name, valueSpec := range secretPack.Secrets {
+		envSecrets, envFromPacks, err := resolveSecrets(opts.Packs, secretPack.UsePacks, secretPack.Secrets)
+		if err != nil {
+			return nil, fmt.Errorf("env '%v': %w", envName, err)
+		}
+
+		for name, valueSpec := range envSecrets {
+			if !opts.Filter.IncludesSecret(name) {
+				continue
+			}
+
+			warnings, err := checkExpiry(valueSpec, time.Now(), opts.ExpiryWindow)
+			if err != nil {
+				secretErrors = append(secretErrors, "env "+envName+" "+name+": "+err.Error())
+				continue
+			}
+
 			stringValue, err := valueSpec.GetRealizedValue()
+			actionsOutput.Mask(stringValue)
 			if err != nil {
-				log.Printf("Error getting realized value %v/%v: %v", fullRepoName, name, err)
+				secretErrors = append(secretErrors, "env "+envName+" "+name+": error getting value: "+err.Error())
 				continue
 			}
 
 			encryptedValue, err := encrypt(publicKey.Key, stringValue)
 			if err != nil {
-				log.Printf("Error encrypting value for secret %v/%v: %v", fullRepoName, name, err)
+				secretErrors = append(secretErrors, "env "+envName+" "+name+": error encrypting value: "+err.Error())
 				continue
 			}
 
-			// TODO: Get secret list for this env here.
-			call := "create"
-			if _, ok := existingSecretNamesForEnv[name]; ok {
-				call = "update"
-			}
+			valueHmac := opts.State.Hmac(stringValue)
+			call, driftWarnings := classifyCall(opts.State, stateKeyForEnv(fullRepoName, envName), name, valueHmac, existingSecretsForEnv)
 
 			envChanges.Calls = append(envChanges.Calls, QualifiedSecretCall{
 				Call:           call,
 				SecretName:     name,
 				EncryptedValue: encryptedValue,
+				ValueHmac:      valueHmac,
+				FromPack:       envFromPacks[name],
+				Warnings:       append(append(warnings, driftWarnings...), rotationWarnings(valueSpec, call, existingSecretsForEnv[name], time.Now())...),
 			})
 
-			if spec.Delete {
-				delete(existingSecretNamesForEnv, name)
-			}
+			delete(existingSecretNamesForEnv, name)
 		}
 
-		if spec.Delete {
+		if spec.DeletesUnspecified() {
 			for name, _ := range existingSecretNamesForEnv {
+				if !opts.Filter.IncludesSecret(name) {
+					continue
+				}
 				envChanges.Calls = append(envChanges.Calls, QualifiedSecretCall{
 					Call:       "delete",
 					SecretName: name,
 				})
 			}
+		} else {
+			envChanges.UnmanagedSecrets = unmanagedNames(existingSecretNamesForEnv, opts.Filter)
 		}
 
 		changes.Envs[envName] = envChanges
 	}
 
-	return changes
+	if len(secretErrors) > 0 {
+		return nil, &ConfigError{strings.Join(secretErrors, "; ")}
+	}
+
+	return changes, nil
 }
 
-func computeCallsForOrg(orgName string, spec SyncSpecOrg, publicKey github.PublicKey, isDry bool) *QualifiedSecretCallsByOrg {
+func computeCallsForOrg(orgName string, spec SyncSpecOrg, publicKey github.PublicKey, opts ComputeOptions) (*QualifiedSecretCallsByOrg, error) {
 	changes := &QualifiedSecretCallsByOrg{
 		KeyId:   publicKey.KeyId,
 		OrgName: orgName,
 		Calls:   []QualifiedSecretCall{},
 	}
 
+	existingSecrets, err := getSecretListForOrg(orgName)
+	if err != nil {
+		return nil, err
+	}
+
+	changes.RemoteFingerprint = fingerprintRemote(publicKey.KeyId, existingSecrets)
+
 	existingSecretNames := map[string]interface{}{}
 
-	for _, name := range getSecretListForOrg(orgName) {
+	for name := range existingSecrets {
 		existingSecretNames[name] = nil
 	}
 
+	secrets, fromPacks, err := resolveSecrets(opts.Packs, spec.UsePacks, spec.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
 	repoIds := getRepoIdsForOrg(orgName)
 
-	for name, valueSpec := range spec.Secrets {
+	secretErrors := []string{}
+
+	for name, valueSpec := range secrets {
+		if !opts.Filter.IncludesSecret(name) {
+			continue
+		}
+
+		warnings, err := checkExpiry(valueSpec, time.Now(), opts.ExpiryWindow)
+		if err != nil {
+			secretErrors = append(secretErrors, name+": "+err.Error())
+			continue
+		}
+
 		stringValue, err := valueSpec.GetRealizedValue()
+		actionsOutput.Mask(stringValue)
 		if err != nil {
-			log.Printf("Error getting realized value %v/%v: %v", orgName, name, err)
+			secretErrors = append(secretErrors, name+": error getting value: "+err.Error())
 			continue
 		}
 
 		encryptedValue, err := encrypt(publicKey.Key, stringValue)
 		if err != nil {
-			log.Printf("Error encrypting value for secret %v/%v: %v", orgName, name, err)
+			secretErrors = append(secretErrors, name+": error encrypting value: "+err.Error())
 			continue
 		}
 
@@ -521,51 +973,60 @@ func computeCallsForOrg(orgName string, spec SyncSpecOrg, publicKey github.Publi
 			}
 		}
 
-		call := "create"
-		if _, ok := existingSecretNames[name]; ok {
-			call = "update"
-		}
+		// Visibility is part of the hash, so that a change in only the visibility isn't skipped as unchanged.
+		valueHmac := opts.State.Hmac(stringValue + "\n" + valueSpec.OrgVisibility + "\n" + fmt.Sprint(thisRepoIds))
+		call, driftWarnings := classifyCall(opts.State, stateKeyForOrg(orgName), name, valueHmac, existingSecrets)
 
 		changes.Calls = append(changes.Calls, QualifiedSecretCall{
 			Call:           call,
 			SecretName:     name,
 			EncryptedValue: encryptedValue,
+			ValueHmac:      valueHmac,
 			OrgVisibility:  valueSpec.OrgVisibility,
 			OrgRepoIds:     thisRepoIds,
+			FromPack:       fromPacks[name],
+			Warnings:       append(append(warnings, driftWarnings...), rotationWarnings(valueSpec, call, existingSecrets[name], time.Now())...),
 		})
 
-		if spec.Delete {
-			delete(existingSecretNames, name)
-		}
+		delete(existingSecretNames, name)
 	}
 
 	if spec.Delete {
 		for name, _ := range existingSecretNames {
+			if !opts.Filter.IncludesSecret(name) {
+				continue
+			}
 			changes.Calls = append(changes.Calls, QualifiedSecretCall{
 				Call:       "delete",
 				SecretName: name,
 			})
 		}
+	} else {
+		changes.UnmanagedSecrets = unmanagedNames(existingSecretNames, opts.Filter)
 	}
 
-	return changes
-}
-
-func getRepoIdsForOrg(name string) map[string]int {
-	body, err := github.MakeGitHubRequest("GET", "orgs/"+name+"/repos?per_page=100", nil)
-	if err != nil {
-		log.Fatalln(err)
+	if len(secretErrors) > 0 {
+		return nil, &ConfigError{strings.Join(secretErrors, "; ")}
 	}
 
-	type Repo struct {
-		Id   int
-		Name string
+	return changes, nil
+}
+
+// Names of secrets on GitHub that are left after removing those in the config, in order.
+func unmanagedNames(existingSecretNames map[string]interface{}, filter Filter) []string {
+	names := []string{}
+	for _, name := range sortedKeys(existingSecretNames) {
+		if filter.IncludesSecret(name) {
+			names = append(names, name)
+		}
 	}
+	return names
+}
 
-	repos := []Repo{}
-	err = json.Unmarshal(body, &repos)
+func getRepoIdsForOrg(name string) map[string]int {
+	repos, err := github.FetchOrgRepos(name)
 	if err != nil {
-		log.Fatalln(err)
+		exitWith(EXIT_API_ERROR, err)
 	}
 
 	repoIdsByName := map[string]int{}
@@ -591,58 +1052,40 @@ func encrypt(key, value string) (string, error) {
 	return base64.StdEncoding.EncodeToString(encryptedValue), nil
 }
 
-func getSecretList(fullRepoName string) []string {
-	body, err := github.MakeGitHubRequest("GET", "repos/"+fullRepoName+"/actions/secrets", nil)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	type Secret struct {
-		Name      string
-		CreatedAt string `json:"created_at"`
-		UpdatedAt string `json:"updated_at"`
-	}
-
-	type Response struct {
-		TotalCount int `json:"total_count"`
-		Secrets    []Secret
-	}
-
-	var response Response
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	names := []string{}
-	for _, secret := range response.Secrets {
-		names = append(names, secret.Name)
-	}
+// Get the existing secrets of a repo, as a map of secret names to their `updated_at` times.
+func getSecretList(fullRepoName string) (map[string]string, error) {
+	return fetchSecretList("repos/" + fullRepoName + "/actions/secrets")
+}
 
-	return names
+// The org secrets that the repo can see.
+func getOrgSecretListForRepo(fullRepoName string) (map[string]string, error) {
+	return fetchSecretList("repos/" + fullRepoName + "/actions/organization-secrets")
 }
 
-func getSecretListForEnv(fullRepoName string, envName string) []string {
-	body, err := github.MakeGitHubRequest("GET", "/repos/"+fullRepoName, nil)
+func getSecretListForEnv(fullRepoName string, envName string) (map[string]string, error) {
+	body, err := github.MakeGitHubRequest("GET", "repos/"+fullRepoName, nil)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
 	type RepoResponse struct {
-		Id string
+		Id int
 	}
 
 	var repoResponse RepoResponse
 	err = json.Unmarshal(body, &repoResponse)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
-	body, err = github.MakeGitHubRequest("GET", "/repositories/"+repoResponse.Id+"/environments/"+envName+"/secrets", nil)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	return fetchSecretList("repositories/" + strconv.Itoa(repoResponse.Id) + "/environments/" + envName + "/secrets")
+}
 
+func getSecretListForOrg(name string) (map[string]string, error) {
+	return fetchSecretList("orgs/" + name + "/actions/secrets")
+}
+
+func fetchSecretList(path string) (map[string]string, error) {
 	type Secret struct {
 		Name      string
 		CreatedAt string `json:"created_at"`
@@ -652,69 +1095,35 @@ func getSecretListForEnv(fullRepoName string, envName string) []string {
 	type Response struct {
 		TotalCount int `json:"total_count"`
 		Secrets    []Secret
+		Message    string
 	}
 
-	var response Response
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	updatedAtByName := map[string]string{}
 
-	names := []string{}
-	for _, secret := range response.Secrets {
-		names = append(names, secret.Name)
-	}
-
-	return names
-}
-
-func getSecretListForOrg(name string) []string {
-	body, err := github.MakeGitHubRequest("GET", "orgs/"+name+"/actions/secrets", nil)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	type Secret struct {
-		Name                string
-		CreatedAt           string `json:"created_at"`
-		UpdatedAt           string `json:"updated_at"`
-		OrgVisibility       string `json:"visibility"`
-		OrgSelectedReposUrl string `json:"selected_repositories_url"`
-	}
-
-	type Response struct {
-		TotalCount int `json:"total_count"`
-		Secrets    []Secret
-	}
-
-	var response Response
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	for page := 1; ; page++ {
+		body, err := github.MakeGitHubRequest("GET", path+"?per_page=100&page="+strconv.Itoa(page), nil)
+		if err != nil {
+			return nil, err
+		}
 
-	names := []string{}
-	for _, secret := range response.Secrets {
-		names = append(names, secret.Name)
-	}
+		var response Response
+		err = json.Unmarshal(body, &response)
+		if err != nil {
+			return nil, err
+		}
 
-	return names
-}
+		if response.Secrets == nil && response.Message != "" {
+			return nil, fmt.Errorf("Error listing secrets at '%v': %v", path, response.Message)
+		}
 
-func loadYaml(filename string) SyncSpec {
-	file, err := os.Open(filename)
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer file.Close()
+		for _, secret := range response.Secrets {
+			updatedAtByName[secret.Name] = secret.UpdatedAt
+		}
 
-	byteValue, err := ioutil.ReadAll(file)
-	if err != nil {
-		fmt.Println(err)
+		if len(response.Secrets) < 100 {
+			break
+		}
 	}
 
-	data := SyncSpec{}
-	yaml.UnmarshalStrict(byteValue, &data)
-
-	return data
+	return updatedAtByName, nil
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sharat87/gass/github"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecretsLocalOverridesPack(t *testing.T) {
+	packs := map[string]SecretPack{
+		"aws": {Secrets: map[string]SecretValueSpec{
+			"AWS_ACCESS_KEY_ID":     {Value: "pack-key"},
+			"AWS_SECRET_ACCESS_KEY": {Value: "pack-secret"},
+		}},
+		"sentry": {Secrets: map[string]SecretValueSpec{
+			"SENTRY_DSN": {Value: "dsn"},
+		}},
+	}
+
+	secrets, fromPacks, err := resolveSecrets(packs, []string{"aws", "sentry"}, map[string]SecretValueSpec{
+		"AWS_ACCESS_KEY_ID": {Value: "local-key"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]SecretValueSpec{
+		"AWS_ACCESS_KEY_ID":     {Value: "local-key"},
+		"AWS_SECRET_ACCESS_KEY": {Value: "pack-secret"},
+		"SENTRY_DSN":            {Value: "dsn"},
+	}, secrets)
+	assert.Equal(t, map[string]string{
+		"AWS_SECRET_ACCESS_KEY": "aws",
+		"SENTRY_DSN":            "sentry",
+	}, fromPacks)
+}
+
+func TestResolveSecretsUnknownPack(t *testing.T) {
+	_, _, err := resolveSecrets(map[string]SecretPack{}, []string{"nope"}, nil)
+	assert.Error(t, err)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Answer requests to GitHub with the given bodies, by path, and query if any, like `repos/a/b?ref=main`, for the rest
+// of the test. Other requests get a 404.
+func stubGitHub(t *testing.T, bodies map[string]string) {
+	originalTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		key := strings.TrimPrefix(req.URL.Path, "/")
+		if req.URL.RawQuery != "" {
+			key += "?" + req.URL.RawQuery
+		}
+
+		status, body := 200, ""
+		if content, ok := bodies[key]; ok {
+			body = content
+		} else {
+			status, body = 404, `{"message": "Not Found"}`
+		}
+		return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})
+	t.Cleanup(func() { http.DefaultClient.Transport = originalTransport })
+}
+
+func TestComputeCallsWithSecretErrors(t *testing.T) {
+	stubGitHub(t, map[string]string{
+		"repos/acme/api/actions/secrets?per_page=100&page=1":              `{"total_count": 0, "secrets": []}`,
+		"repos/acme/api/actions/organization-secrets?per_page=100&page=1": `{"total_count": 0, "secrets": []}`,
+	})
+
+	_, err := computeCalls("acme/api", SyncSpecRepo{Secrets: map[string]SecretValueSpec{
+		"EXPIRED": {Value: "one", Expires: "2000-01-01"},
+		"BOTH":    {Value: "two", FromEnv: "TWO"},
+	}}, github.PublicKey{}, ComputeOptions{})
+
+	assert.ErrorContains(t, err, "EXPIRED: Expired on 2000-01-01")
+	assert.ErrorContains(t, err, "BOTH: error getting value: Both `Value` and `FromEnv` were provided")
+	assert.Equal(t, EXIT_CONFIG_INVALID, exitCodeForError(err))
+}
+
+func TestFetchSecretListPaginates(t *testing.T) {
+	firstPage := []string{}
+	for i := 0; i < 100; i++ {
+		firstPage = append(firstPage, fmt.Sprintf(`{"name": "SECRET_%v", "updated_at": "2022-01-01T00:00:00Z"}`, i))
+	}
+
+	stubGitHub(t, map[string]string{
+		"repos/acme/api/actions/organization-secrets?per_page=100&page=1": `{"total_count": 101, "secrets": [` + strings.Join(firstPage, ", ") + `]}`,
+		"repos/acme/api/actions/organization-secrets?per_page=100&page=2": `{"total_count": 101, "secrets": [{"name": "LAST", "updated_at": "2022-02-01T00:00:00Z"}]}`,
+	})
+
+	secrets, err := getOrgSecretListForRepo("acme/api")
+	assert.NoError(t, err)
+	assert.Len(t, secrets, 101)
+	assert.Equal(t, "2022-02-01T00:00:00Z", secrets["LAST"])
+}
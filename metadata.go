@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Secrets expiring within this duration cause a warning, unless changed with `--expiry-window`.
+const DEFAULT_EXPIRY_WINDOW = 30 * 24 * time.Hour
+
+// Parse a duration like Go's `time.ParseDuration`, but also allowing days and weeks, like `90d` or `2w`.
+func parseDuration(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(value, suffix) {
+			count, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+			if err != nil {
+				return 0, fmt.Errorf("Invalid duration '%v'", value)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+
+	return time.ParseDuration(value)
+}
+
+// Parse the `expires` date of a secret. Full timestamps are also accepted, since that's what dates in TOML configs end up
+// as.
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return date, fmt.Errorf("Invalid date '%v', should be like 2006-01-02", value)
+	}
+
+	return date, nil
+}
+
+// Check the expiry metadata of a secret. Expired secrets produce an error, and secrets expiring within `window` of `now`
+// produce a warning.
+func checkExpiry(spec SecretValueSpec, now time.Time, window time.Duration) ([]string, error) {
+	if spec.RotateEvery != "" {
+		if _, err := parseDuration(spec.RotateEvery); err != nil {
+			return nil, fmt.Errorf("Invalid `rotate_every`: %v", err)
+		}
+	}
+
+	if spec.Expires == "" {
+		return nil, nil
+	}
+
+	expires, err := parseDate(spec.Expires)
+	if err != nil {
+		return nil, err
+	}
+
+	if !now.Before(expires) {
+		return nil, fmt.Errorf("Expired on %v%v", expires.Format("2006-01-02"), ownerNote(spec))
+	}
+
+	if expires.Sub(now) <= window {
+		return []string{fmt.Sprintf("Expires on %v, in %v%v", expires.Format("2006-01-02"), daysUntil(now, expires), ownerNote(spec))}, nil
+	}
+
+	return nil, nil
+}
+
+// Warnings for a secret that's kept unchanged, but was last changed on GitHub, at `updatedAt`, longer than its
+// `rotate_every` ago. Secrets that are created or updated are being rotated, so they don't need a warning.
+func rotationWarnings(spec SecretValueSpec, call, updatedAt string, now time.Time) []string {
+	if spec.RotateEvery == "" || call != "unchanged" {
+		return nil
+	}
+
+	// Invalid durations are reported by `checkExpiry`.
+	rotateEvery, err := parseDuration(spec.RotateEvery)
+	if err != nil {
+		return nil
+	}
+
+	lastChanged, err := time.Parse(time.RFC3339, updatedAt)
+	if err != nil || now.Sub(lastChanged) < rotateEvery {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("Due for rotation, last changed on %v, should be rotated every %v%v", lastChanged.Format("2006-01-02"), spec.RotateEvery, ownerNote(spec))}
+}
+
+func ownerNote(spec SecretValueSpec) string {
+	if spec.Owner == "" {
+		return ""
+	}
+	return " (owner " + spec.Owner + ")"
+}
+
+func daysUntil(now, then time.Time) string {
+	days := int(then.Sub(now).Hours() / 24)
+	if days == 1 {
+		return "1 day"
+	}
+	return strconv.Itoa(days) + " days"
+}
+
+// Print the metadata of all secrets in the given configs, as a table. Secrets are listed where they are defined, so
+// secrets from packs are listed under the pack, not under every repo using it.
+func printReport(secretsConfigs []SyncSpec, now time.Time, window time.Duration) {
+	type Row struct {
+		Target string
+		Name   string
+		Spec   SecretValueSpec
+	}
+
+	rows := []Row{}
+	addRows := func(target string, secrets map[string]SecretValueSpec) {
+		for name, spec := range secrets {
+			rows = append(rows, Row{target, name, spec})
+		}
+	}
+
+	for _, secretsConfig := range secretsConfigs {
+		for name, pack := range secretsConfig.Packs {
+			addRows("pack "+name, pack.Secrets)
+		}
+		for name, repo := range secretsConfig.Repos {
+			addRows("repo "+name, repo.Secrets)
+			for envName, env := range repo.Envs {
+				addRows("repo "+name+" env "+envName, env.Secrets)
+			}
+		}
+		for _, selector := range secretsConfig.RepoSelectors {
+			addRows("selector "+selector.String(), selector.Secrets)
+			for envName, env := range selector.Envs {
+				addRows("selector "+selector.String()+" env "+envName, env.Secrets)
+			}
+		}
+		for name, org := range secretsConfig.Orgs {
+			addRows("org "+name, org.Secrets)
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Target != rows[j].Target {
+			return rows[i].Target < rows[j].Target
+		}
+		return rows[i].Name < rows[j].Name
+	})
+
+	writer := tabwriter.NewWriter(textOut, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TARGET\tSECRET\tOWNER\tEXPIRES\tSTATUS\tROTATE EVERY\tDESCRIPTION")
+
+	for _, row := range rows {
+		status := "ok"
+		warnings, err := checkExpiry(row.Spec, now, window)
+		if err != nil {
+			status = err.Error()
+		} else if len(warnings) > 0 {
+			status = "expires in " + daysUntil(now, mustParseDate(row.Spec.Expires))
+		}
+
+		fmt.Fprintln(writer, strings.Join([]string{
+			row.Target,
+			row.Name,
+			orDash(row.Spec.Owner),
+			orDash(row.Spec.Expires),
+			status,
+			orDash(row.Spec.RotateEvery),
+			orDash(row.Spec.Description),
+		}, "\t"))
+	}
+
+	writer.Flush()
+}
+
+func mustParseDate(value string) time.Time {
+	date, _ := parseDate(value)
+	return date
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	d, err := parseDuration("90d")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*24*time.Hour, d)
+
+	d, err = parseDuration("2w")
+	assert.NoError(t, err)
+	assert.Equal(t, 14*24*time.Hour, d)
+
+	d, err = parseDuration("36h")
+	assert.NoError(t, err)
+	assert.Equal(t, 36*time.Hour, d)
+
+	_, err = parseDuration("xd")
+	assert.Error(t, err)
+}
+
+func TestCheckExpiry(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	window := 30 * 24 * time.Hour
+
+	warnings, err := checkExpiry(SecretValueSpec{}, now, window)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	warnings, err = checkExpiry(SecretValueSpec{Expires: "2022-12-31"}, now, window)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	warnings, err = checkExpiry(SecretValueSpec{Expires: "2022-06-11", Owner: "ops"}, now, window)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Expires on 2022-06-11, in 9 days (owner ops)"}, warnings)
+
+	_, err = checkExpiry(SecretValueSpec{Expires: "2022-05-01"}, now, window)
+	assert.EqualError(t, err, "Expired on 2022-05-01")
+
+	_, err = checkExpiry(SecretValueSpec{Expires: "2022-05-01T00:00:00Z"}, now, window)
+	assert.EqualError(t, err, "Expired on 2022-05-01")
+
+	_, err = checkExpiry(SecretValueSpec{RotateEvery: "often"}, now, window)
+	assert.Error(t, err)
+}
+
+func TestRotationWarnings(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	spec := SecretValueSpec{RotateEvery: "90d", Owner: "ops"}
+
+	assert.Equal(t, []string{"Due for rotation, last changed on 2022-01-15, should be rotated every 90d (owner ops)"},
+		rotationWarnings(spec, "unchanged", "2022-01-15T10:00:00Z", now))
+	assert.Empty(t, rotationWarnings(spec, "unchanged", "2022-05-01T10:00:00Z", now))
+	assert.Empty(t, rotationWarnings(spec, "update", "2022-01-15T10:00:00Z", now))
+	assert.Empty(t, rotationWarnings(SecretValueSpec{}, "unchanged", "2022-01-15T10:00:00Z", now))
+}
+
+func TestParseTomlConfigWithExpiry(t *testing.T) {
+	spec, err := parseConfig([]byte(`
+[orgs.acme.secrets.ONE]
+value = "one"
+expires = 2022-12-31
+`), "toml")
+	assert.NoError(t, err)
+
+	date, err := parseDate(spec.Orgs["acme"].Secrets["ONE"].Expires)
+	assert.NoError(t, err)
+	assert.Equal(t, "2022-12-31", date.Format("2006-01-02"))
+}
+
+func TestPrintReportIncludesEnvs(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	configs := []SyncSpec{{
+		Repos: map[string]SyncSpecRepo{
+			"acme/api": {Envs: map[string]SecretPack{
+				"production": {Secrets: map[string]SecretValueSpec{"DEPLOY_KEY": {Value: "x", Owner: "ops"}}},
+			}},
+		},
+		RepoSelectors: []RepoSelector{{Org: "acme", SyncSpecRepo: SyncSpecRepo{Envs: map[string]SecretPack{
+			"staging": {Secrets: map[string]SecretValueSpec{"STAGING_KEY": {Value: "x", Expires: "2022-01-01"}}},
+		}}}},
+	}}
+
+	code, output := catchExit(t, func() { printReport(configs, now, 30*24*time.Hour) })
+
+	assert.Equal(t, -1, code)
+	assert.Regexp(t, `repo acme/api env production\s+DEPLOY_KEY\s+ops`, output)
+	assert.Regexp(t, `selector org acme env staging\s+STAGING_KEY\s+-\s+2022-01-01\s+Expired`, output)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sharat87/gass/github"
+	"github.com/sharat87/gass/report"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Where the human readable output goes. Discarded when `--output` is `json` or `ndjson`, so that stdout only has the
+// machine readable output.
+var textOut io.Writer = os.Stdout
+
+// Where prompts and workflow commands go. Since stdout is reserved for the machine readable output, when `--output` is
+// `json` or `ndjson`, it's stderr instead.
+var statusOut io.Writer = os.Stdout
+
+// Styles for human readable output, disabled with `--no-color`, `NO_COLOR`, or when stdout isn't a terminal.
+var style report.Style
+
+// Renders the plan, and the results of applying it, in the format given with `--output`.
+var reporter report.Reporter = &report.TextReporter{Out: os.Stdout}
+
+func setupOutput(format string, noColor bool) error {
+	style = report.Style{IsEnabled: !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)}
+
+	switch format {
+	case "", "text":
+		reporter = &report.TextReporter{Out: os.Stdout, Style: style}
+
+	case "json", "ndjson":
+		reporter = report.NewJSONReporter(os.Stdout, format == "ndjson", Version)
+		textOut = ioutil.Discard
+		statusOut = os.Stderr
+
+	default:
+		return fmt.Errorf("Unknown output format '%v', should be one of `text`, `json` or `ndjson`", format)
+	}
+
+	return nil
+}
+
+// Report the plan, and return it, to check for things like used secrets set for deletion. Unused secrets get a warning
+// if `unusedMode` is `warn` or `error`, and are only marked as unused otherwise.
+func reportPlan(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg, unusedMode string) report.Plan {
+	plan := buildPlan(allChanges, allChangesForOrgs)
+	if unusedMode == "warn" || unusedMode == "error" {
+		warnUnused(&plan)
+	}
+	reporter.Plan(plan)
+	actionsOutput.AddPlan(plan)
+	return plan
+}
+
+// Report the secrets that no workflow uses, for `gass audit unused`.
+func reportAudit(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg) {
+	reporter.Plan(buildAudit(allChanges, allChangesForOrgs))
+}
+
+func reportResults(results []AppliedCall) {
+	reportResults := buildResults(results)
+	reporter.Results(reportResults)
+	actionsOutput.AddResults(reportResults)
+}
+
+// Write out everything that's only written at the end, before exiting.
+func flushOutputs() {
+	reporter.Flush()
+	actionsOutput.Flush()
+}
+
+func buildPlan(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg) report.Plan {
+	summary, _ := summarizeChanges(allChanges, allChangesForOrgs, 0)
+	plan := report.Plan{Targets: []report.Target{}, Summary: summary}
+
+	for _, org := range allChangesForOrgs {
+		// Org secrets are only looked for in repos that can see them, so there are none that could be missing.
+		orgTarget := buildPlanTarget("org", org.OrgName, "", org.Calls, org.UsedSecrets, nil)
+		addWarnings(&orgTarget, func(secretName string) []string {
+			return orgShadowedWarnings(org.OrgName, secretName, allChanges)
+		})
+		plan.Targets = append(plan.Targets, orgTarget)
+	}
+
+	for _, repo := range allChanges {
+		levels := plannedSecretLevels(repo, allChangesForOrgs)
+		repoTarget := buildPlanTarget("repo", repo.FullRepoName, "", repo.Calls, repo.UsedSecrets, missingCandidates(repo, "", levels))
+		markUnused(&repoTarget, unusedSecrets(repo.Calls, nil, repo.UsedSecrets))
+		addWarnings(&repoTarget, func(secretName string) []string {
+			return append(repoFallbackWarnings(repo, secretName), overrideWarnings(levels, "", secretName)...)
+		})
+		plan.Targets = append(plan.Targets, repoTarget)
+
+		envNames := []string{}
+		for envName := range repo.Envs {
+			envNames = append(envNames, envName)
+		}
+		sort.Strings(envNames)
+
+		for _, envName := range envNames {
+			env := repo.Envs[envName]
+			envTarget := buildPlanTarget("repo", repo.FullRepoName, envName, env.Calls, env.UsedSecrets, missingCandidates(repo, envName, levels))
+			markUnused(&envTarget, unusedSecrets(env.Calls, nil, env.UsedSecrets))
+			addWarnings(&envTarget, func(secretName string) []string {
+				return overrideWarnings(levels, envName, secretName)
+			})
+			plan.Targets = append(plan.Targets, envTarget)
+		}
+	}
+
+	return plan
+}
+
+// The unused secrets of every target, each with the action `unused`. Org secrets are included too, since auditing looks
+// into every repo that can see them. Secrets that aren't in the config have a warning saying so.
+func buildAudit(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg) report.Plan {
+	plan := report.Plan{Targets: []report.Target{}}
+
+	for _, org := range allChangesForOrgs {
+		unused := unusedSecrets(org.Calls, org.UnmanagedSecrets, org.UsedSecrets)
+		plan.Targets = append(plan.Targets, buildAuditTarget("org", org.OrgName, "", unused, org.UnmanagedSecrets))
+	}
+
+	for _, repo := range allChanges {
+		unused := unusedSecrets(repo.Calls, repo.UnmanagedSecrets, repo.UsedSecrets)
+		plan.Targets = append(plan.Targets, buildAuditTarget("repo", repo.FullRepoName, "", unused, repo.UnmanagedSecrets))
+
+		for _, envName := range sortedKeys(repo.Envs) {
+			env := repo.Envs[envName]
+			unused := unusedSecrets(env.Calls, env.UnmanagedSecrets, env.UsedSecrets)
+			plan.Targets = append(plan.Targets, buildAuditTarget("repo", repo.FullRepoName, envName, unused, env.UnmanagedSecrets))
+		}
+	}
+
+	return plan
+}
+
+func buildAuditTarget(targetType, name, envName string, unused, unmanaged []string) report.Target {
+	target := report.Target{Type: targetType, Name: name, Env: envName, Secrets: []report.Secret{}}
+
+	isUnmanaged := map[string]bool{}
+	for _, secretName := range unmanaged {
+		isUnmanaged[secretName] = true
+	}
+
+	for _, secretName := range unused {
+		secret := report.Secret{Name: secretName, Action: "unused"}
+		if isUnmanaged[secretName] {
+			secret.Warnings = []string{"Not in the config files"}
+		}
+		target.Secrets = append(target.Secrets, secret)
+	}
+
+	return target
+}
+
+// Add warnings to the secrets that are kept, leaving those being deleted, or missing, as they are.
+func addWarnings(target *report.Target, warningsFor func(secretName string) []string) {
+	for i, secret := range target.Secrets {
+		if secret.Action == "delete" || secret.Action == "missing" {
+			continue
+		}
+		if warnings := warningsFor(secret.Name); len(warnings) > 0 {
+			target.Secrets[i].Warnings = append(append([]string{}, secret.Warnings...), warnings...)
+		}
+	}
+}
+
+// Mark the given secrets as unused, unless they are being deleted, or are missing.
+func markUnused(target *report.Target, unused []string) {
+	isUnused := map[string]bool{}
+	for _, name := range unused {
+		isUnused[name] = true
+	}
+
+	for i, secret := range target.Secrets {
+		if secret.Action != "delete" && secret.Action != "missing" && isUnused[secret.Name] {
+			target.Secrets[i].Unused = true
+		}
+	}
+}
+
+func warnUnused(plan *report.Plan) {
+	for _, target := range plan.Targets {
+		for i, secret := range target.Secrets {
+			if secret.Unused {
+				target.Secrets[i].Warnings = append(append([]string{}, secret.Warnings...), "Not used by any workflow")
+			}
+		}
+	}
+}
+
+// Secrets in `candidates` that aren't in the calls are reported as missing.
+func buildPlanTarget(targetType, name, envName string, calls []QualifiedSecretCall, usedSecrets, candidates map[string][]github.SecretUsage) report.Target {
+	target := report.Target{Type: targetType, Name: name, Env: envName, Secrets: []report.Secret{}}
+	specifiedSecrets := map[string]interface{}{}
+
+	for _, call := range calls {
+		secret := report.Secret{
+			Name:     call.SecretName,
+			Action:   call.Call,
+			FromPack: call.FromPack,
+			Warnings: call.Warnings,
+		}
+
+		// Secrets being deleted are reported with where they are used, rather than as missing.
+		if call.Call == "delete" {
+			secret.UsedIn = usageStrings(usedSecrets[call.SecretName])
+		}
+		specifiedSecrets[call.SecretName] = nil
+
+		target.Secrets = append(target.Secrets, secret)
+	}
+
+	for _, name := range sortedKeys(candidates) {
+		if _, ok := specifiedSecrets[name]; !ok {
+			target.Secrets = append(target.Secrets, report.Secret{
+				Name:   name,
+				Action: "missing",
+				UsedIn: usageStrings(candidates[name]),
+			})
+		}
+	}
+
+	return target
+}
+
+// Where a secret is used, like `deploy.yml:12 (job deploy, step Publish)`, without duplicates.
+func usageStrings(usages []github.SecretUsage) []string {
+	strs := []string{}
+	seen := map[string]bool{}
+	for _, usage := range usages {
+		if str := usage.String(); !seen[str] {
+			strs = append(strs, str)
+			seen[str] = true
+		}
+	}
+	return strs
+}
+
+func buildResults(results []AppliedCall) []report.Result {
+	reportResults := []report.Result{}
+
+	for _, result := range results {
+		reportResult := report.Result{
+			TargetType: result.TargetType,
+			Target:     result.Target,
+			Env:        result.EnvName,
+			Secret:     result.Call.SecretName,
+			Action:     result.Call.Call,
+			Status:     "ok",
+			HttpStatus: result.StatusCode,
+		}
+
+		if result.Err != nil {
+			reportResult.Status = "error"
+			reportResult.Error = result.Err.Error()
+
+			var apiErr *github.APIError
+			if errors.As(result.Err, &apiErr) {
+				reportResult.HttpStatus = apiErr.StatusCode
+			}
+		}
+
+		reportResults = append(reportResults, reportResult)
+	}
+
+	return reportResults
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"github.com/sharat87/gass/github"
+	"github.com/sharat87/gass/report"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuildPlan(t *testing.T) {
+	plan := buildPlan([]QualifiedSecretCallsByRepo{
+		{
+			FullRepoName: "sharat87/prestige",
+			Calls: []QualifiedSecretCall{
+				{Call: "create", SecretName: "ONE", EncryptedValue: "encrypted-one", FromPack: "aws"},
+				{Call: "delete", SecretName: "TWO"},
+			},
+			UsedSecrets: map[string][]github.SecretUsage{
+				"TWO": {
+					{File: "build.yml", Job: "build", Step: "Publish", Line: 12},
+					{File: "build.yml", Job: "build", Step: "Publish", Line: 12},
+					{File: "deploy.yml", Job: "deploy", Line: 5},
+				},
+				"THREE": {{File: "build.yml", Line: 3}},
+			},
+			Envs: map[string]QualifiedSecretCallsByRepoEnv{
+				"staging": {
+					Calls:       []QualifiedSecretCall{{Call: "delete", SecretName: "FIVE"}},
+					UsedSecrets: map[string][]github.SecretUsage{"FIVE": {{File: "deploy.yml", Job: "deploy", Step: "#2", Line: 9}}},
+				},
+				"production": {Calls: []QualifiedSecretCall{
+					{Call: "unchanged", SecretName: "ONE", Warnings: []string{"expires soon"}},
+					{Call: "delete", SecretName: "FOUR"},
+				}},
+			},
+		},
+	}, []QualifiedSecretCallsByOrg{
+		{OrgName: "acme", Calls: []QualifiedSecretCall{{Call: "update", SecretName: "ORG_ONE"}}},
+	})
+
+	assert.Equal(t, report.Plan{
+		Targets: []report.Target{
+			{Type: "org", Name: "acme", Secrets: []report.Secret{
+				{Name: "ORG_ONE", Action: "update"},
+			}},
+			{Type: "repo", Name: "sharat87/prestige", Secrets: []report.Secret{
+				{Name: "ONE", Action: "create", FromPack: "aws", Unused: true},
+				{Name: "TWO", Action: "delete", UsedIn: []string{"build.yml:12 (job build, step Publish)", "deploy.yml:5 (job deploy)"}},
+				{Name: "THREE", Action: "missing", UsedIn: []string{"build.yml:3"}},
+			}},
+			{Type: "repo", Name: "sharat87/prestige", Env: "production", Secrets: []report.Secret{
+				{Name: "ONE", Action: "unchanged", Unused: true, Warnings: []string{"expires soon", "Overrides the repo secret with the same name"}},
+				{Name: "FOUR", Action: "delete", UsedIn: []string{}},
+			}},
+			{Type: "repo", Name: "sharat87/prestige", Env: "staging", Secrets: []report.Secret{
+				{Name: "FIVE", Action: "delete", UsedIn: []string{"deploy.yml:9 (job deploy, step #2)"}},
+			}},
+		},
+		Summary: report.Summary{Creates: 1, Updates: 1, Deletes: 3, Repos: 1, Orgs: 1},
+	}, plan)
+
+	// Env deletions are checked against the env's usage, not the repo's.
+	assert.Equal(t, 2, plan.UsedDeletions())
+	assert.Equal(t, 2, plan.UnusedSecrets())
+}
+
+func TestBuildPlanWithEnvUsages(t *testing.T) {
+	usedSecrets := map[string][]github.SecretUsage{
+		"DEPLOY_KEY": {{File: "deploy.yml", Job: "deploy", Line: 9, Environment: "Production"}},
+		"API_TOKEN":  {{File: "deploy.yml", Job: "deploy", Line: 10, Environment: "production"}},
+		"NPM_TOKEN":  {{File: "deploy.yml", Job: "deploy", Line: 11, Environment: "production"}},
+		"OLD_KEY":    {{File: "release.yml", Job: "release", Line: 4, Environment: "${{ inputs.env }}"}},
+		"BUILD_KEY":  {{File: "build.yml", Job: "build", Line: 5}},
+	}
+
+	plan := buildPlan([]QualifiedSecretCallsByRepo{
+		{
+			FullRepoName: "sharat87/prestige",
+			Calls: []QualifiedSecretCall{
+				{Call: "update", SecretName: "DEPLOY_KEY"},
+				{Call: "update", SecretName: "NPM_TOKEN"},
+			},
+			UsedSecrets: usedSecrets,
+			Envs: map[string]QualifiedSecretCallsByRepoEnv{
+				"production": {
+					Calls: []QualifiedSecretCall{
+						{Call: "update", SecretName: "NPM_TOKEN"},
+						{Call: "delete", SecretName: "OLD_KEY"},
+					},
+					UsedSecrets: usagesInEnv(usedSecrets, "production"),
+				},
+			},
+		},
+	}, nil)
+
+	assert.Equal(t, []report.Target{
+		{Type: "repo", Name: "sharat87/prestige", Secrets: []report.Secret{
+			{Name: "DEPLOY_KEY", Action: "update", Warnings: []string{"Used by jobs in env 'production', but only defined at repo level"}},
+			{Name: "NPM_TOKEN", Action: "update"},
+			{Name: "BUILD_KEY", Action: "missing", UsedIn: []string{"build.yml:5 (job build)"}},
+			{Name: "OLD_KEY", Action: "missing", UsedIn: []string{"release.yml:4 (job release, env ${{ inputs.env }})"}},
+		}},
+		{Type: "repo", Name: "sharat87/prestige", Env: "production", Secrets: []report.Secret{
+			{Name: "NPM_TOKEN", Action: "update", Warnings: []string{"Overrides the repo secret with the same name"}},
+			{Name: "OLD_KEY", Action: "delete", UsedIn: []string{"release.yml:4 (job release, env ${{ inputs.env }})"}},
+			{Name: "API_TOKEN", Action: "missing", UsedIn: []string{"deploy.yml:10 (job deploy, env production)"}},
+		}},
+	}, plan.Targets)
+}
+
+func TestBuildPlanMissingSecrets(t *testing.T) {
+	usedSecrets := map[string][]github.SecretUsage{
+		"GITHUB_TOKEN":  {{File: "ci.yml", Job: "test", Line: 3}},
+		"github_token":  {{File: "release.yml", Job: "release", Line: 6}},
+		"SENTRY_DSN":    {{File: "ci.yml", Job: "test", Line: 4}},
+		"LEFTOVER":      {{File: "ci.yml", Job: "test", Line: 5}},
+		"RETIRED":       {{File: "ci.yml", Job: "test", Line: 6}},
+		"STAGING_KEY":   {{File: "deploy.yml", Job: "deploy", Line: 8, Environment: "${{ inputs.env }}"}},
+		"UNDEFINED_KEY": {{File: "deploy.yml", Job: "deploy", Line: 9, Environment: "production"}},
+		"PROD_ONLY_KEY": {{File: "deploy.yml", Job: "deploy", Line: 10, Environment: "production"}},
+		"PREVIEW_KEY":   {{File: "preview.yml", Job: "preview", Line: 5, Environment: "preview"}},
+		"QA_KEY":        {{File: "qa.yml", Job: "qa", Line: 5, Environment: "qa"}},
+	}
+
+	plan := buildPlan([]QualifiedSecretCallsByRepo{
+		{
+			FullRepoName:     "acme/api",
+			Calls:            []QualifiedSecretCall{},
+			UsedSecrets:      usedSecrets,
+			UnmanagedSecrets: []string{"LEFTOVER"},
+			OrgSecrets:       []string{"SENTRY_DSN", "RETIRED"},
+			OtherEnvSecrets:  map[string][]string{"preview": {"PREVIEW_KEY"}},
+			Envs: map[string]QualifiedSecretCallsByRepoEnv{
+				"production": {
+					Calls:       []QualifiedSecretCall{},
+					UsedSecrets: usagesInEnv(usedSecrets, "production"),
+				},
+				"staging": {
+					Calls:            []QualifiedSecretCall{},
+					UsedSecrets:      usagesInEnv(usedSecrets, "staging"),
+					UnmanagedSecrets: []string{"STAGING_KEY"},
+				},
+			},
+		},
+	}, []QualifiedSecretCallsByOrg{
+		{OrgName: "acme", Calls: []QualifiedSecretCall{{Call: "delete", SecretName: "RETIRED"}}},
+	})
+
+	// Built-in secrets, org secrets the repo can see, and secrets that aren't in the config, including those of envs that
+	// aren't in the config, all resolve.
+	assert.Equal(t, []report.Target{
+		{Type: "org", Name: "acme", Secrets: []report.Secret{
+			{Name: "RETIRED", Action: "delete", UsedIn: []string{}},
+		}},
+		{Type: "repo", Name: "acme/api", Secrets: []report.Secret{
+			{Name: "QA_KEY", Action: "missing", UsedIn: []string{"qa.yml:5 (job qa, env qa)"}},
+			{Name: "RETIRED", Action: "missing", UsedIn: []string{"ci.yml:6 (job test)"}},
+		}},
+		{Type: "repo", Name: "acme/api", Env: "production", Secrets: []report.Secret{
+			{Name: "PROD_ONLY_KEY", Action: "missing", UsedIn: []string{"deploy.yml:10 (job deploy, env production)"}},
+			{Name: "UNDEFINED_KEY", Action: "missing", UsedIn: []string{"deploy.yml:9 (job deploy, env production)"}},
+		}},
+		{Type: "repo", Name: "acme/api", Env: "staging", Secrets: []report.Secret{}},
+	}, plan.Targets)
+}
+
+func TestBuildResults(t *testing.T) {
+	results := buildResults([]AppliedCall{
+		{TargetType: "repo", Target: "sharat87/prestige", Call: QualifiedSecretCall{Call: "create", SecretName: "ONE"}, StatusCode: 201},
+		{TargetType: "org", Target: "acme", Call: QualifiedSecretCall{Call: "delete", SecretName: "TWO"}, StatusCode: 404, Err: &github.APIError{StatusCode: 404, Message: "Not Found"}},
+		{TargetType: "repo", Target: "sharat87/prestige", EnvName: "production", Call: QualifiedSecretCall{Call: "update", SecretName: "THREE"}, Err: errors.New("connection refused")},
+	})
+
+	assert.Equal(t, []report.Result{
+		{TargetType: "repo", Target: "sharat87/prestige", Secret: "ONE", Action: "create", Status: "ok", HttpStatus: 201},
+		{TargetType: "org", Target: "acme", Secret: "TWO", Action: "delete", Status: "error", HttpStatus: 404, Error: "HTTP 404: Not Found"},
+		{TargetType: "repo", Target: "sharat87/prestige", Env: "production", Secret: "THREE", Action: "update", Status: "error", Error: "connection refused"},
+	}, results)
+}
+
+func TestSetupOutputUnknownFormat(t *testing.T) {
+	assert.Error(t, setupOutput("xml", true))
+}
+
+func TestBuildAudit(t *testing.T) {
+	plan := buildAudit([]QualifiedSecretCallsByRepo{
+		{
+			FullRepoName: "sharat87/prestige",
+			Calls: []QualifiedSecretCall{
+				{Call: "unchanged", SecretName: "NPM_TOKEN"},
+				{Call: "update", SecretName: "OLD_TOKEN"},
+				{Call: "delete", SecretName: "GONE"},
+			},
+			UsedSecrets:      map[string][]github.SecretUsage{"npm_token": {{File: "ci.yml", Line: 4}}},
+			UnmanagedSecrets: []string{"LEFTOVER"},
+			Envs: map[string]QualifiedSecretCallsByRepoEnv{
+				"production": {Calls: []QualifiedSecretCall{{Call: "create", SecretName: "DEPLOY_KEY"}}},
+			},
+		},
+	}, []QualifiedSecretCallsByOrg{
+		{
+			OrgName:          "acme",
+			Calls:            []QualifiedSecretCall{{Call: "unchanged", SecretName: "SENTRY_DSN"}},
+			UsedSecrets:      map[string][]github.SecretUsage{"SENTRY_DSN": {{File: "ci.yml", Line: 9, Repo: "acme/api"}}},
+			UnmanagedSecrets: []string{"ORG_LEFTOVER"},
+		},
+	})
+
+	assert.Equal(t, []report.Target{
+		{Type: "org", Name: "acme", Secrets: []report.Secret{
+			{Name: "ORG_LEFTOVER", Action: "unused", Warnings: []string{"Not in the config files"}},
+		}},
+		{Type: "repo", Name: "sharat87/prestige", Secrets: []report.Secret{
+			{Name: "OLD_TOKEN", Action: "unused"},
+			{Name: "LEFTOVER", Action: "unused", Warnings: []string{"Not in the config files"}},
+		}},
+		{Type: "repo", Name: "sharat87/prestige", Env: "production", Secrets: []report.Secret{
+			{Name: "DEPLOY_KEY", Action: "unused"},
+		}},
+	}, plan.Targets)
+}
+
+func TestWarnUnused(t *testing.T) {
+	plan := report.Plan{Targets: []report.Target{{Type: "repo", Name: "a/b", Secrets: []report.Secret{
+		{Name: "ONE", Action: "create", Unused: true, Warnings: []string{"expires soon"}},
+		{Name: "TWO", Action: "create"},
+	}}}}
+
+	warnUnused(&plan)
+
+	assert.Equal(t, []string{"expires soon", "Not used by any workflow"}, plan.Targets[0].Secrets[0].Warnings)
+	assert.Empty(t, plan.Targets[0].Secrets[1].Warnings)
+}
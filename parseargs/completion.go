@@ -0,0 +1,232 @@
+package parseargs
+
+import (
+	"sort"
+	"strings"
+)
+
+var SHELLS = []string{"bash", "zsh", "fish"}
+
+// Printed as the only completion, when the shell should complete file names instead.
+const FILE_COMPLETION = "__files__"
+
+// Values for flags that depend on the config files, like repo and org names. Gets the args parsed so far, which have
+// the config files to read from.
+type DynamicValues func(flagName string, ia InvokeArgs) []string
+
+// Completions for the last of the given words, which is the one being typed, and may be empty. The words don't include
+// the program name.
+func Complete(words []string, dynamic DynamicValues) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+
+	current := words[len(words)-1]
+
+	if len(words) == 1 {
+		return withPrefix(commandNames(), current)
+	}
+
+	command, ok := findCommand(words[0])
+	if !ok || command.IsRaw {
+		return []string{}
+	}
+
+	ia, position := parseLeniently(command, words[1:len(words)-1])
+
+	// A value for the previous flag, like `--repo <tab>`. Bash splits `--repo=<tab>` into three words, with `=` in the
+	// middle, so that's handled here as well.
+	previous := words[len(words)-2]
+	if previous == "=" && len(words) > 2 {
+		previous = words[len(words)-3]
+	}
+	if strings.HasPrefix(previous, "-") && !strings.Contains(previous, "=") {
+		if flag, ok := findFlag(command, strings.TrimLeft(previous, "-")); ok && flag.ValueName != "" {
+			return flagValues(flag, ia, dynamic, "", current)
+		}
+	}
+
+	// A value in the same word, like `--repo=<tab>`.
+	if name, value, hasValue := strings.Cut(current, "="); hasValue && strings.HasPrefix(name, "-") {
+		if flag, ok := findFlag(command, strings.TrimLeft(name, "-")); ok && flag.ValueName != "" {
+			return flagValues(flag, ia, dynamic, name+"=", value)
+		}
+		return []string{}
+	}
+
+	if strings.HasPrefix(current, "-") || position >= command.MaxArgs {
+		flagNames := []string{}
+		for _, name := range command.Flags {
+			flagNames = append(flagNames, "--"+name)
+		}
+		return withPrefix(flagNames, current)
+	}
+
+	if command.Name == "help" {
+		return withPrefix(commandNames(), current)
+	}
+
+	if len(command.ArgValues) > 0 {
+		return withPrefix(command.ArgValues, current)
+	}
+
+	if position < len(command.ArgNames) {
+		if dynamic == nil {
+			return []string{}
+		}
+		return withPrefix(dynamic(command.ArgNames[position], ia), current)
+	}
+
+	return []string{FILE_COMPLETION}
+}
+
+// Parse the words typed so far, ignoring any errors, since they are still being typed. Also returns the number of
+// positional arguments in them.
+func parseLeniently(command Command, words []string) (InvokeArgs, int) {
+	ia := InvokeArgs{Action: command.Name}
+	position := 0
+
+	for i := 0; i < len(words); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(words[i], "-"), "=")
+		if !strings.HasPrefix(words[i], "-") {
+			position++
+			continue
+		}
+
+		flag, ok := findFlag(command, name)
+		if !ok || flag.ValueName == "" {
+			continue
+		}
+
+		if !hasValue {
+			// Bash splits `--file=x` into `--file`, `=` and `x`.
+			if i+1 < len(words) && words[i+1] == "=" {
+				i++
+			}
+			if i+1 >= len(words) {
+				break
+			}
+			i++
+			value = words[i]
+		}
+
+		flag.set(&ia, value)
+	}
+
+	// Commands that don't take config files still complete their arguments from the default one.
+	if ia.Files == nil && (hasFlag(command, "file") || len(command.ArgNames) > 0) {
+		ia.Files = []string{"secrets.yml"}
+	}
+
+	return ia, position
+}
+
+func flagValues(flag Flag, ia InvokeArgs, dynamic DynamicValues, prefix, current string) []string {
+	if flag.ValueName == "file" || flag.ValueName == "dir" {
+		return []string{FILE_COMPLETION}
+	}
+
+	values := flag.Values
+	if values == nil && dynamic != nil {
+		values = dynamic(flag.Name, ia)
+	}
+
+	completions := []string{}
+	for _, value := range withPrefix(values, current) {
+		completions = append(completions, prefix+value)
+	}
+	return completions
+}
+
+func commandNames() []string {
+	names := []string{}
+	for _, command := range Commands {
+		if !command.IsHidden {
+			names = append(names, command.Name)
+		}
+	}
+	return names
+}
+
+// The values that start with the given prefix, sorted, and without duplicates.
+func withPrefix(values []string, prefix string) []string {
+	matches := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) && !seen[value] {
+			matches = append(matches, value)
+			seen[value] = true
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// A script that completes gass commands in the given shell, by calling `gass __complete`. So completions always match
+// the commands and flags of the gass being run.
+func CompletionScript(shell string) string {
+	switch shell {
+	case "bash":
+		return BASH_COMPLETION
+	case "zsh":
+		return ZSH_COMPLETION
+	case "fish":
+		return FISH_COMPLETION
+	}
+	return ""
+}
+
+const BASH_COMPLETION = `# bash completion for gass. Load with:
+#   source <(gass completion bash)
+
+_gass() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local IFS=$'\n'
+    local candidates=($(gass __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+    if [[ "${candidates[0]}" == "` + FILE_COMPLETION + `" ]]; then
+        COMPREPLY=($(compgen -f -- "$cur"))
+    else
+        COMPREPLY=("${candidates[@]}")
+    fi
+}
+
+complete -F _gass gass
+`
+
+const ZSH_COMPLETION = `#compdef gass
+# zsh completion for gass. Load with:
+#   source <(gass completion zsh)
+
+_gass() {
+    local -a candidates
+    candidates=("${(@f)$(gass __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ "${candidates[1]}" == "` + FILE_COMPLETION + `" ]]; then
+        _files
+    else
+        compadd -- "${candidates[@]}"
+    fi
+}
+
+if [[ "${funcstack[1]}" == "_gass" ]]; then
+    _gass "$@"
+else
+    compdef _gass gass
+fi
+`
+
+const FISH_COMPLETION = `# fish completion for gass. Load with:
+#   gass completion fish | source
+
+function __gass_complete
+    set -l tokens (commandline -opc)
+    set -l current (commandline -ct)
+    set -l candidates (gass __complete $tokens[2..-1] "$current" 2>/dev/null)
+    if test "$candidates[1]" = "` + FILE_COMPLETION + `"
+        __fish_complete_path (commandline -ct)
+    else
+        printf '%s\n' $candidates
+    end
+end
+
+complete -c gass -f -a '(__gass_complete)'
+`
@@ -0,0 +1,52 @@
+package parseargs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	dynamic := func(flagName string, ia InvokeArgs) []string {
+		return []string{flagName + "-from-" + strings.Join(ia.Files, ",")}
+	}
+
+	tests := []struct {
+		name     string
+		words    []string
+		expected []string
+	}{
+		{"commands", []string{""}, []string{"apply", "audit", "completion", "explain", "help", "plan", "report", "sync", "validate", "version"}},
+		{"command prefix", []string{"v"}, []string{"validate", "version"}},
+		{"flags", []string{"apply", "--s"}, []string{"--state"}},
+		{"flags without arguments", []string{"validate", ""}, []string{"--expiry-window", "--file", "--format"}},
+		{"fixed values", []string{"plan", "--output", ""}, []string{"json", "ndjson", "text"}},
+		{"fixed values in same word", []string{"plan", "--output=n"}, []string{"--output=ndjson"}},
+		{"dynamic values", []string{"sync", "--repo", ""}, []string{"repo-from-secrets.yml"}},
+		{"dynamic values from given files", []string{"sync", "--file", "a.yml", "--file=b.yml", "--org", ""}, []string{"org-from-a.yml,b.yml"}},
+		{"bash split value", []string{"sync", "--file", "=", "a.yml", "--env", "=", ""}, []string{"env-from-a.yml"}},
+		{"file flag", []string{"sync", "--file", ""}, []string{FILE_COMPLETION}},
+		{"file argument", []string{"apply", "pl"}, []string{FILE_COMPLETION}},
+		{"help argument", []string{"help", "ap"}, []string{"apply"}},
+		{"audit argument", []string{"audit", ""}, []string{"unused"}},
+		{"dynamic arguments", []string{"explain", ""}, []string{"repo-from-secrets.yml"}},
+		{"second dynamic argument", []string{"explain", "--no-color", "acme/api", ""}, []string{"secret-from-secrets.yml"}},
+		{"after all arguments", []string{"explain", "acme/api", "ONE", ""}, []string{"--no-cache", "--no-color", "--workflows-from", "--workflows-ref"}},
+		{"completion argument", []string{"completion", ""}, []string{"bash", "fish", "zsh"}},
+		{"unknown command", []string{"deploy", ""}, []string{}},
+		{"unknown flag value", []string{"sync", "--fast=x"}, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Complete(test.words, dynamic))
+		})
+	}
+}
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range SHELLS {
+		assert.Contains(t, CompletionScript(shell), "gass __complete")
+	}
+	assert.Empty(t, CompletionScript("powershell"))
+}
@@ -2,13 +2,111 @@ package parseargs
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
 func TestParseJustSync(t *testing.T) {
-	ia := ParseArgs([]string{"sync"})
+	ia, err := ParseArgs([]string{"sync"})
+	assert.NoError(t, err)
 	assert.Equal(t, InvokeArgs{
 		Action: "sync",
 		Files: []string{"secrets.yml"},
 	}, ia)
 }
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected InvokeArgs
+	}{
+		{"no args", []string{}, InvokeArgs{Action: "help"}},
+		{"help", []string{"help"}, InvokeArgs{Action: "help"}},
+		{"help flag", []string{"--help"}, InvokeArgs{Action: "help"}},
+		{"help for command", []string{"help", "apply"}, InvokeArgs{Action: "help", HelpFor: "apply"}},
+		{"help flag for command", []string{"sync", "--file", "a.yml", "-h"}, InvokeArgs{Action: "help", HelpFor: "sync", Files: []string{"a.yml"}}},
+		{"version", []string{"version"}, InvokeArgs{Action: "version"}},
+		{"version flag", []string{"--version"}, InvokeArgs{Action: "version"}},
+		{"files", []string{"sync", "--file", "a.yml", "--file=b.yml"}, InvokeArgs{Action: "sync", Files: []string{"a.yml", "b.yml"}}},
+		{"stdin file", []string{"plan", "--file", "-", "--format", "json"}, InvokeArgs{Action: "plan", Files: []string{"-"}, Format: "json"}},
+		{"booleans", []string{"sync", "--dry", "-y", "--no-color=true", "--force-delete-used=false"}, InvokeArgs{Action: "sync", Files: []string{"secrets.yml"}, IsDry: true, Yes: true, NoColor: true}},
+		{"detailed exit code", []string{"plan", "--detailed-exitcode"}, InvokeArgs{Action: "plan", Files: []string{"secrets.yml"}, DetailedExitCode: true}},
+		{"workflows", []string{"plan", "--workflows-from", "../checkout", "--workflows-ref=feature"}, InvokeArgs{Action: "plan", Files: []string{"secrets.yml"}, WorkflowsFrom: "../checkout", WorkflowsRef: "feature"}},
+		{"no cache", []string{"sync", "--no-cache"}, InvokeArgs{Action: "sync", Files: []string{"secrets.yml"}, NoCache: true}},
+		{"single dash long flag", []string{"plan", "-out", "plan.json"}, InvokeArgs{Action: "plan", Files: []string{"secrets.yml"}, PlanOut: "plan.json"}},
+		{"filters", []string{"sync", "--repo", "acme/*", "--repo=other/*", "--secret", "AWS_*", "--org", "acme", "--env", "prod"}, InvokeArgs{
+			Action:  "sync",
+			Files:   []string{"secrets.yml"},
+			Repos:   []string{"acme/*", "other/*"},
+			Orgs:    []string{"acme"},
+			Envs:    []string{"prod"},
+			Secrets: []string{"AWS_*"},
+		}},
+		{"apply", []string{"apply", "--yes", "plan.json", "--state", "state.json"}, InvokeArgs{Action: "apply", Yes: true, PlanFile: "plan.json", StateFile: "state.json"}},
+		{"apply after double dash", []string{"apply", "--", "--plan.json"}, InvokeArgs{Action: "apply", PlanFile: "--plan.json"}},
+		{"validate", []string{"validate", "--expiry-window=14d"}, InvokeArgs{Action: "validate", Files: []string{"secrets.yml"}, ExpiryWindow: "14d"}},
+		{"completion", []string{"completion", "zsh"}, InvokeArgs{Action: "completion", Shell: "zsh"}},
+		{"unused as error", []string{"sync", "--unused", "error"}, InvokeArgs{Action: "sync", Files: []string{"secrets.yml"}, Unused: "error"}},
+		{"explain", []string{"explain", "acme/api", "NPM_TOKEN", "--workflows-ref", "main"}, InvokeArgs{Action: "explain", ExplainRepo: "acme/api", ExplainSecret: "NPM_TOKEN", WorkflowsRef: "main"}},
+		{"audit unused", []string{"audit", "unused", "--repo", "acme/*"}, InvokeArgs{Action: "audit", Audit: "unused", Files: []string{"secrets.yml"}, Repos: []string{"acme/*"}}},
+		{"complete words", []string{"__complete", "sync", "--repo", ""}, InvokeArgs{Action: "__complete", CompleteArgs: []string{"sync", "--repo", ""}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ia, err := ParseArgs(test.args)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, ia)
+		})
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+	}{
+		{"unknown command", []string{"deploy"}, "Unknown command 'deploy'"},
+		{"unknown flag", []string{"sync", "--fast"}, "Unknown flag '--fast' for command 'sync'"},
+		{"flag of another command", []string{"apply", "plan.json", "--dry"}, "Unknown flag '--dry' for command 'apply'"},
+		{"missing value", []string{"sync", "--file"}, "Missing value for flag '--file'"},
+		{"invalid boolean", []string{"sync", "--dry=maybe"}, "Invalid value 'maybe' for flag '--dry', should be true or false"},
+		{"unexpected argument", []string{"sync", "secrets.yml"}, "Unexpected argument 'secrets.yml' for command 'sync'"},
+		{"too many arguments", []string{"apply", "one.json", "two.json"}, "Unexpected argument 'two.json' for command 'apply'"},
+		{"apply without plan", []string{"apply"}, "Missing the plan file to apply, like `gass apply plan.json`"},
+		{"help for unknown command", []string{"help", "deploy"}, "Unknown command 'deploy'"},
+		{"completion without shell", []string{"completion"}, "Missing the shell, should be one of bash, zsh or fish"},
+		{"completion for unknown shell", []string{"completion", "tcsh"}, "Unknown shell 'tcsh', should be one of bash, zsh or fish"},
+		{"invalid unused mode", []string{"plan", "--unused=fail"}, "Invalid value 'fail' for flag '--unused', should be one of info, warn or error"},
+		{"explain without secret", []string{"explain", "acme/api"}, "Missing the repo and secret to explain, like `gass explain acme/api NPM_TOKEN`"},
+		{"explain invalid repo", []string{"explain", "api", "NPM_TOKEN"}, "Invalid repo 'api', should be like `owner/repo`"},
+		{"audit without what", []string{"audit"}, "Missing what to audit, should be one of unused"},
+		{"unknown audit", []string{"audit", "expiry"}, "Unknown audit 'expiry', should be one of unused"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseArgs(test.args)
+			assert.EqualError(t, err, test.error)
+		})
+	}
+}
+
+func TestHelp(t *testing.T) {
+	help := Help("")
+	for _, command := range Commands {
+		if command.IsHidden {
+			assert.NotContains(t, help, "  "+command.Name+" ")
+		} else {
+			assert.Contains(t, help, "  "+command.Name+" ")
+		}
+	}
+
+	applyHelp := Help("apply")
+	assert.True(t, strings.HasPrefix(applyHelp, "Usage:\n  gass apply [flags] <plan-file>\n"))
+	assert.Contains(t, applyHelp, "-y, --yes")
+	assert.Contains(t, applyHelp, "--state <file>")
+	assert.NotContains(t, applyHelp, "--dry")
+}
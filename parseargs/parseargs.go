@@ -1,47 +1,441 @@
 package parseargs
 
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
 type InvokeArgs struct {
-	Action string
-	IsDry bool
-	Files []string
+	Action                 string
+	HelpFor                string // the command to show help for, if `Action` is "help".
+	IsDry                  bool
+	DetailedExitCode       bool
+	Files                  []string
+	Format                 string
+	ExpiryWindow           string
+	StateFile              string
+	PlanOut                string
+	PlanFile               string
+	ForceDeleteUsed        bool
+	Yes                    bool
+	DeleteConfirmThreshold string
+	Repos                  []string
+	Orgs                   []string
+	Envs                   []string
+	Secrets                []string
+	WorkflowsFrom          string
+	WorkflowsRef           string
+	NoCache                bool
+	Unused                 string // how to report unused secrets, one of `UNUSED_MODES`, or empty for the default.
+	Audit                  string // what to audit, if `Action` is "audit".
+	ExplainRepo            string // the repo to explain a secret of, if `Action` is "explain".
+	ExplainSecret          string
+	Output                 string
+	NoColor                bool
+	Shell                  string   // to generate completions for, if `Action` is "completion".
+	CompleteArgs           []string // the words to complete, if `Action` is "__complete".
 }
 
-func ParseArgs(args []string) InvokeArgs {
-	ia := &InvokeArgs{}
+type Flag struct {
+	Name      string   // used as `--name`, or `-name`.
+	Short     string   // used as `-s`, optional.
+	ValueName string   // shown in help, empty for boolean flags.
+	Values    []string // possible values, for completions.
+	Usage     string
+	set       func(ia *InvokeArgs, value string)
+}
 
-	state := ""
+type Command struct {
+	Name      string
+	Args      string // positional arguments, as shown in help.
+	MaxArgs   int
+	ArgValues []string // possible values of positional arguments, for completions. Files, if empty.
+	ArgNames  []string // names of dynamic values for each positional argument, like `repo`, for completions.
+	Usage     string
+	Flags     []string // names of the flags this command takes.
+	IsHidden  bool     // not shown in help, or completions.
+	IsRaw     bool     // all arguments are positional, even if they look like flags.
+	setArg    func(ia *InvokeArgs, value string)
+}
 
-	firstArg := args[0]
+var configFlags = []string{"file", "format", "expiry-window"}
+var filterFlags = []string{"repo", "org", "env", "secret"}
+var outputFlags = []string{"output", "no-color"}
+var workflowFlags = []string{"workflows-from", "workflows-ref", "no-cache"}
 
-	if firstArg == "sync" {
-		ia.Action = firstArg
+var UNUSED_MODES = []string{"info", "warn", "error"}
+var AUDITS = []string{"unused"}
+
+var Flags = []Flag{
+	{Name: "file", ValueName: "file", Usage: "Config file to use, `-` for stdin. Can be given multiple times. Defaults to `secrets.yml`.", set: func(ia *InvokeArgs, value string) {
+		ia.Files = append(ia.Files, value)
+	}},
+	{Name: "format", ValueName: "yaml|json|toml", Values: []string{"yaml", "json", "toml"}, Usage: "Format of the config files. Defaults to going by the file extension.", set: func(ia *InvokeArgs, value string) {
+		ia.Format = value
+	}},
+	{Name: "expiry-window", ValueName: "duration", Usage: "Warn about secrets expiring within this duration. Defaults to `30d`.", set: func(ia *InvokeArgs, value string) {
+		ia.ExpiryWindow = value
+	}},
+	{Name: "state", ValueName: "file", Usage: "State file, to skip pushing secrets that haven't changed.", set: func(ia *InvokeArgs, value string) {
+		ia.StateFile = value
+	}},
+	{Name: "out", ValueName: "file", Usage: "Save the plan to this file, to be applied later with `gass apply`.", set: func(ia *InvokeArgs, value string) {
+		ia.PlanOut = value
+	}},
+	{Name: "dry", Usage: "Only show what would be done, without changing anything.", set: func(ia *InvokeArgs, value string) {
+		ia.IsDry = value == "true"
+	}},
+	{Name: "detailed-exitcode", Usage: "Exit with 2 if there are changes that weren't applied, like with `plan` or `--dry`.", set: func(ia *InvokeArgs, value string) {
+		ia.DetailedExitCode = value == "true"
+	}},
+	{Name: "force-delete-used", Usage: "Delete secrets even if they are used in workflows.", set: func(ia *InvokeArgs, value string) {
+		ia.ForceDeleteUsed = value == "true"
+	}},
+	{Name: "yes", Short: "y", Usage: "Apply without asking for confirmation.", set: func(ia *InvokeArgs, value string) {
+		ia.Yes = value == "true"
+	}},
+	{Name: "delete-confirm-threshold", ValueName: "count", Usage: "Ask to type the name of repos and orgs with more deletions than this. Defaults to 5.", set: func(ia *InvokeArgs, value string) {
+		ia.DeleteConfirmThreshold = value
+	}},
+	{Name: "repo", ValueName: "glob", Usage: "Only touch matching repos. Can be given multiple times.", set: func(ia *InvokeArgs, value string) {
+		ia.Repos = append(ia.Repos, value)
+	}},
+	{Name: "org", ValueName: "glob", Usage: "Only touch matching orgs, and repos in them. Can be given multiple times.", set: func(ia *InvokeArgs, value string) {
+		ia.Orgs = append(ia.Orgs, value)
+	}},
+	{Name: "env", ValueName: "glob", Usage: "Only touch matching envs. Can be given multiple times.", set: func(ia *InvokeArgs, value string) {
+		ia.Envs = append(ia.Envs, value)
+	}},
+	{Name: "secret", ValueName: "glob", Usage: "Only touch matching secrets. Can be given multiple times.", set: func(ia *InvokeArgs, value string) {
+		ia.Secrets = append(ia.Secrets, value)
+	}},
+	{Name: "workflows-from", ValueName: "dir", Usage: "Find used secrets in the workflows of this local checkout, instead of on GitHub. Only for a single repo.", set: func(ia *InvokeArgs, value string) {
+		ia.WorkflowsFrom = value
+	}},
+	{Name: "workflows-ref", ValueName: "ref", Usage: "Find used secrets in the workflows at this branch, tag or commit, instead of the default branch.", set: func(ia *InvokeArgs, value string) {
+		ia.WorkflowsRef = value
+	}},
+	{Name: "no-cache", Usage: "Download and parse all workflows, instead of using the ones cached by earlier runs.", set: func(ia *InvokeArgs, value string) {
+		ia.NoCache = value == "true"
+	}},
+	{Name: "unused", ValueName: "info|warn|error", Values: UNUSED_MODES, Usage: "How to report secrets in the config that no workflow uses. `error` exits without applying. Defaults to `info`.", set: func(ia *InvokeArgs, value string) {
+		ia.Unused = value
+	}},
+	{Name: "output", ValueName: "text|json|ndjson", Values: []string{"text", "json", "ndjson"}, Usage: "Format of the output. Defaults to `text`.", set: func(ia *InvokeArgs, value string) {
+		ia.Output = value
+	}},
+	{Name: "no-color", Usage: "Don't use colors in the output.", set: func(ia *InvokeArgs, value string) {
+		ia.NoColor = value == "true"
+	}},
+}
+
+var Commands = []Command{
+	{
+		Name:  "sync",
+		Usage: "Set secrets on GitHub as given in the config files.",
+		Flags: concat(configFlags, []string{"state", "dry", "detailed-exitcode", "force-delete-used", "unused", "yes", "delete-confirm-threshold"}, filterFlags, workflowFlags, outputFlags),
+	},
+	{
+		Name:  "plan",
+		Usage: "Show the changes that sync would make, optionally saving them to apply later.",
+		Flags: concat(configFlags, []string{"state", "out", "detailed-exitcode", "force-delete-used", "unused"}, filterFlags, workflowFlags, outputFlags),
+	},
+	{
+		Name:    "apply",
+		Args:    "<plan-file>",
+		MaxArgs: 1,
+		Usage:   "Apply a plan saved with `gass plan --out`.",
+		Flags:   concat([]string{"state", "force-delete-used", "yes", "delete-confirm-threshold"}, outputFlags),
+		setArg: func(ia *InvokeArgs, value string) {
+			ia.PlanFile = value
+		},
+	},
+	{
+		Name:  "validate",
+		Usage: "Check the config files for errors, without calling GitHub.",
+		Flags: configFlags,
+	},
+	{
+		Name:  "report",
+		Usage: "List all secrets in the config files, along with their metadata.",
+		Flags: configFlags,
+	},
+	{
+		Name:      "audit",
+		Args:      "<unused>",
+		MaxArgs:   1,
+		ArgValues: AUDITS,
+		Usage:     "List secrets in the config files, or on GitHub, that no workflow uses.",
+		Flags:     concat(configFlags, filterFlags, workflowFlags, outputFlags),
+		setArg: func(ia *InvokeArgs, value string) {
+			ia.Audit = value
+		},
+	},
+	{
+		Name:     "explain",
+		Args:     "<repo> <secret>",
+		MaxArgs:  2,
+		ArgNames: []string{"repo", "secret"},
+		Usage:    "Show where a secret of a repo comes from, for jobs in each env, as it is on GitHub now.",
+		Flags:    concat(workflowFlags, []string{"no-color"}),
+		setArg: func(ia *InvokeArgs, value string) {
+			if ia.ExplainRepo == "" {
+				ia.ExplainRepo = value
+			} else {
+				ia.ExplainSecret = value
+			}
+		},
+	},
+	{
+		Name:  "version",
+		Usage: "Show the version of gass.",
+	},
+	{
+		Name:      "completion",
+		Args:      "<bash|zsh|fish>",
+		MaxArgs:   1,
+		ArgValues: SHELLS,
+		Usage:     "Print a script for completing commands, flags, and repo and org names in the given shell.",
+		setArg: func(ia *InvokeArgs, value string) {
+			ia.Shell = value
+		},
+	},
+	{
+		Name:     "__complete",
+		Usage:    "Print completions for the given words, used by completion scripts.",
+		IsHidden: true,
+		IsRaw:    true,
+		setArg: func(ia *InvokeArgs, value string) {
+			ia.CompleteArgs = append(ia.CompleteArgs, value)
+		},
+	},
+	{
+		Name:    "help",
+		Args:    "[command]",
+		MaxArgs: 1,
+		Usage:   "Show help for gass, or for a command.",
+		setArg: func(ia *InvokeArgs, value string) {
+			ia.HelpFor = value
+		},
+	},
+}
 
-	} else if firstArg == "--help" || firstArg == "-h" || firstArg == "help" {
+func ParseArgs(args []string) (InvokeArgs, error) {
+	ia := &InvokeArgs{}
+
+	if len(args) == 0 {
 		ia.Action = "help"
-		return *ia
+		return *ia, nil
+	}
 
+	firstArg := args[0]
+	if firstArg == "--help" || firstArg == "-h" {
+		firstArg = "help"
+	} else if firstArg == "--version" {
+		firstArg = "version"
 	}
 
-	for _, arg := range args[1:] {
-		if state == "file" {
-			state = ""
-			if ia.Files == nil {
-				ia.Files = []string{}
+	command, ok := findCommand(firstArg)
+	if !ok {
+		return *ia, fmt.Errorf("Unknown command '%v'", firstArg)
+	}
+	ia.Action = command.Name
+
+	argCount := 0
+	isFlagsDone := false
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+
+		if command.IsRaw {
+			command.setArg(ia, arg)
+			continue
+		}
+
+		if !isFlagsDone && arg == "--" {
+			isFlagsDone = true
+			continue
+		}
+
+		if isFlagsDone || arg == "-" || !strings.HasPrefix(arg, "-") {
+			if argCount >= command.MaxArgs {
+				return *ia, fmt.Errorf("Unexpected argument '%v' for command '%v'", arg, command.Name)
 			}
-			ia.Files = append(ia.Files, arg)
+			command.setArg(ia, arg)
+			argCount++
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+
+		if name == "help" || name == "h" {
+			ia.HelpFor = command.Name
+			ia.Action = "help"
+			return *ia, nil
+		}
+
+		flag, ok := findFlag(command, name)
+		if !ok {
+			return *ia, fmt.Errorf("Unknown flag '--%v' for command '%v'", name, command.Name)
+		}
+
+		if flag.ValueName == "" {
+			if hasValue {
+				isSet, err := strconv.ParseBool(value)
+				if err != nil {
+					return *ia, fmt.Errorf("Invalid value '%v' for flag '--%v', should be true or false", value, flag.Name)
+				}
+				value = strconv.FormatBool(isSet)
+			} else {
+				value = "true"
+			}
+
+		} else if !hasValue {
+			if i+1 >= len(args) {
+				return *ia, fmt.Errorf("Missing value for flag '--%v'", flag.Name)
+			}
+			i++
+			value = args[i]
+		}
+
+		flag.set(ia, value)
+	}
+
+	if ia.Action == "apply" && ia.PlanFile == "" {
+		return *ia, fmt.Errorf("Missing the plan file to apply, like `gass apply plan.json`")
+	}
+
+	if ia.Action == "completion" && ia.Shell == "" {
+		return *ia, fmt.Errorf("Missing the shell, should be one of bash, zsh or fish")
+	} else if ia.Action == "completion" && !contains(SHELLS, ia.Shell) {
+		return *ia, fmt.Errorf("Unknown shell '%v', should be one of bash, zsh or fish", ia.Shell)
+	}
 
-		} else if arg == "--dry" {
-			ia.IsDry = true
+	if ia.Action == "audit" && ia.Audit == "" {
+		return *ia, fmt.Errorf("Missing what to audit, should be one of unused")
+	} else if ia.Action == "audit" && !contains(AUDITS, ia.Audit) {
+		return *ia, fmt.Errorf("Unknown audit '%v', should be one of unused", ia.Audit)
+	}
 
-		} else if arg == "--file" {
-			state = "file"
+	if ia.Action == "explain" && ia.ExplainSecret == "" {
+		return *ia, fmt.Errorf("Missing the repo and secret to explain, like `gass explain acme/api NPM_TOKEN`")
+	} else if ia.Action == "explain" && strings.Count(ia.ExplainRepo, "/") != 1 {
+		return *ia, fmt.Errorf("Invalid repo '%v', should be like `owner/repo`", ia.ExplainRepo)
+	}
+
+	if ia.Unused != "" && !contains(UNUSED_MODES, ia.Unused) {
+		return *ia, fmt.Errorf("Invalid value '%v' for flag '--unused', should be one of info, warn or error", ia.Unused)
+	}
 
+	if ia.Action == "help" && ia.HelpFor != "" {
+		if _, ok := findCommand(ia.HelpFor); !ok {
+			return *ia, fmt.Errorf("Unknown command '%v'", ia.HelpFor)
 		}
 	}
 
-	if ia.Files == nil {
+	if ia.Files == nil && hasFlag(command, "file") {
 		ia.Files = []string{"secrets.yml"}
 	}
 
-	return *ia
+	return *ia, nil
+}
+
+// Help text for the given command, or for gass itself if the command is empty.
+func Help(commandName string) string {
+	buffer := &bytes.Buffer{}
+	writer := tabwriter.NewWriter(buffer, 0, 4, 2, ' ', 0)
+
+	command, ok := findCommand(commandName)
+	if !ok {
+		fmt.Fprintln(buffer, "gass, GitHub Actions Secrets Sync.")
+		fmt.Fprintln(buffer, "")
+		fmt.Fprintln(buffer, "Usage:")
+		fmt.Fprintln(buffer, "  gass <command> [flags]")
+		fmt.Fprintln(buffer, "")
+		fmt.Fprintln(buffer, "Commands:")
+		for _, command := range Commands {
+			if !command.IsHidden {
+				fmt.Fprintln(writer, "  "+command.Name+"\t"+command.Usage)
+			}
+		}
+		writer.Flush()
+		fmt.Fprintln(buffer, "")
+		fmt.Fprintln(buffer, "Run `gass help <command>` for the flags of a command.")
+		return buffer.String()
+	}
+
+	usage := "gass " + command.Name
+	if len(command.Flags) > 0 {
+		usage += " [flags]"
+	}
+	if command.Args != "" {
+		usage += " " + command.Args
+	}
+
+	fmt.Fprintln(buffer, "Usage:")
+	fmt.Fprintln(buffer, "  "+usage)
+	fmt.Fprintln(buffer, "")
+	fmt.Fprintln(buffer, command.Usage)
+
+	if len(command.Flags) > 0 {
+		fmt.Fprintln(buffer, "")
+		fmt.Fprintln(buffer, "Flags:")
+		for _, name := range command.Flags {
+			flag, _ := findFlag(command, name)
+			spec := "--" + flag.Name
+			if flag.Short != "" {
+				spec = "-" + flag.Short + ", " + spec
+			}
+			if flag.ValueName != "" {
+				spec += " <" + flag.ValueName + ">"
+			}
+			fmt.Fprintln(writer, "  "+spec+"\t"+flag.Usage)
+		}
+		writer.Flush()
+	}
+
+	return buffer.String()
+}
+
+func findCommand(name string) (Command, bool) {
+	for _, command := range Commands {
+		if command.Name == name {
+			return command, true
+		}
+	}
+	return Command{}, false
+}
+
+// Find a flag by its name or short name, only if the command takes it.
+func findFlag(command Command, name string) (Flag, bool) {
+	for _, flag := range Flags {
+		if (flag.Name == name || (flag.Short != "" && flag.Short == name)) && hasFlag(command, flag.Name) {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+func hasFlag(command Command, name string) bool {
+	return contains(command.Flags, name)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func concat(lists ...[]string) []string {
+	result := []string{}
+	for _, list := range lists {
+		result = append(result, list...)
+	}
+	return result
 }
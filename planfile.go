@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/sharat87/gass/github"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+// Version 2 has where secrets are used, with jobs and steps, instead of just the files.
+const PLAN_FILE_VERSION = 2
+
+// A plan saved with `gass plan --out`, to be applied later with `gass apply`. Secret values in it are already encrypted
+// with the public keys of the targets, so it can only be applied as long as those keys haven't changed.
+type PlanFile struct {
+	Version     int
+	GassVersion string
+	CreatedAt   string
+	Repos       []QualifiedSecretCallsByRepo
+	Orgs        []QualifiedSecretCallsByOrg
+}
+
+// Fingerprint of the state of a target on GitHub, as seen when planning. Includes the public key, since the encrypted
+// values in a plan are only valid with that key.
+func fingerprintRemote(keyId string, existingSecrets map[string]string) string {
+	names := []string{}
+	for name := range existingSecrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "key %q\n", keyId)
+	for _, name := range names {
+		fmt.Fprintf(hash, "secret %q %q\n", name, existingSecrets[name])
+	}
+
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
+}
+
+func savePlanFile(filename string, allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg) error {
+	content, err := json.MarshalIndent(PlanFile{
+		Version:     PLAN_FILE_VERSION,
+		GassVersion: Version,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Repos:       allChanges,
+		Orgs:        allChangesForOrgs,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, content, 0600)
+}
+
+func loadPlanFile(filename string) (PlanFile, error) {
+	plan := PlanFile{}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return plan, err
+	}
+
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return plan, err
+	}
+
+	if plan.Version != PLAN_FILE_VERSION {
+		return plan, fmt.Errorf("Unsupported plan file version %v, expected %v", plan.Version, PLAN_FILE_VERSION)
+	}
+
+	return plan, nil
+}
+
+// Check that the state of all targets on GitHub is the same as when the plan was made. Returns a list of targets that
+// have changed since.
+func verifyPlanFile(plan PlanFile) ([]string, error) {
+	changed := []string{}
+
+	for _, repo := range plan.Repos {
+		publicKey, err := github.FetchPublicKey(repo.FullRepoName)
+		if err != nil {
+			return nil, err
+		}
+
+		existingSecrets, err := getSecretList(repo.FullRepoName)
+		if err != nil {
+			return nil, err
+		}
+
+		if publicKey.KeyId != repo.KeyId || fingerprintRemote(publicKey.KeyId, existingSecrets) != repo.RemoteFingerprint {
+			changed = append(changed, "repo "+repo.FullRepoName)
+		}
+
+		for envName, env := range repo.Envs {
+			existingSecretsForEnv, err := getSecretListForEnv(repo.FullRepoName, envName)
+			if err != nil {
+				return nil, err
+			}
+
+			if fingerprintRemote(publicKey.KeyId, existingSecretsForEnv) != env.RemoteFingerprint {
+				changed = append(changed, "repo "+repo.FullRepoName+" env "+envName)
+			}
+		}
+	}
+
+	for _, org := range plan.Orgs {
+		publicKey, err := github.FetchPublicKeyForOrg(org.OrgName)
+		if err != nil {
+			return nil, err
+		}
+
+		existingSecrets, err := getSecretListForOrg(org.OrgName)
+		if err != nil {
+			return nil, err
+		}
+
+		if publicKey.KeyId != org.KeyId || fingerprintRemote(publicKey.KeyId, existingSecrets) != org.RemoteFingerprint {
+			changed = append(changed, "org "+org.OrgName)
+		}
+	}
+
+	return changed, nil
+}
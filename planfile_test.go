@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprintRemote(t *testing.T) {
+	existing := map[string]string{"ONE": "2022-06-01T00:00:00Z", "TWO": "2022-06-02T00:00:00Z"}
+	fingerprint := fingerprintRemote("key-1", existing)
+
+	assert.Equal(t, fingerprint, fingerprintRemote("key-1", map[string]string{"TWO": "2022-06-02T00:00:00Z", "ONE": "2022-06-01T00:00:00Z"}))
+	assert.NotEqual(t, fingerprint, fingerprintRemote("key-2", existing))
+	assert.NotEqual(t, fingerprint, fingerprintRemote("key-1", map[string]string{"ONE": "2022-06-01T00:00:00Z"}))
+	assert.NotEqual(t, fingerprint, fingerprintRemote("key-1", map[string]string{"ONE": "2022-06-01T00:00:00Z", "TWO": "2022-06-03T00:00:00Z"}))
+}
+
+func TestPlanFileSaveAndLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "plan.json")
+
+	repos := []QualifiedSecretCallsByRepo{{
+		KeyId:        "key-1",
+		FullRepoName: "sharat87/prestige",
+		Calls: []QualifiedSecretCall{
+			{Call: "create", SecretName: "ONE", EncryptedValue: "encrypted"},
+		},
+		RemoteFingerprint: "fingerprint",
+	}}
+
+	assert.NoError(t, savePlanFile(filename, repos, nil))
+
+	plan, err := loadPlanFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, PLAN_FILE_VERSION, plan.Version)
+	assert.Equal(t, repos, plan.Repos)
+}
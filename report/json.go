@@ -0,0 +1,134 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// A single secret in the plan, as written in JSON. Never includes secret values, encrypted or otherwise.
+type PlanEntry struct {
+	Type       string   `json:"type"`        // always "plan".
+	TargetType string   `json:"target_type"` // "repo" or "org".
+	Target     string   `json:"target"`
+	Env        string   `json:"env,omitempty"`
+	Secret     string   `json:"secret"`
+	Action     string   `json:"action"`
+	FromPack   string   `json:"from_pack,omitempty"`
+	UsedIn     []string `json:"used_in,omitempty"`
+	Unused     bool     `json:"unused,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+type resultEntry struct {
+	Type string `json:"type"` // always "result".
+	Result
+}
+
+type summaryEntry struct {
+	Type string `json:"type"` // always "summary".
+	Summary
+}
+
+// The single document written by `JSONReporter`, unless streaming.
+type Document struct {
+	GassVersion string      `json:"gass_version"`
+	Plan        []PlanEntry `json:"plan"`
+	Summary     Summary     `json:"summary"`
+	Applied     bool        `json:"applied"`
+	Results     []Result    `json:"results"`
+}
+
+// Writes a single JSON document when flushed. If streaming, writes each entry as a line of JSON as soon as it's
+// available instead, as NDJSON, along with a line for the summary.
+type JSONReporter struct {
+	Out         io.Writer
+	IsStreaming bool
+	Document    Document
+	isFlushed   bool
+}
+
+func NewJSONReporter(out io.Writer, isStreaming bool, gassVersion string) *JSONReporter {
+	return &JSONReporter{
+		Out:         out,
+		IsStreaming: isStreaming,
+		Document: Document{
+			GassVersion: gassVersion,
+			Plan:        []PlanEntry{},
+			Results:     []Result{},
+		},
+	}
+}
+
+func (reporter *JSONReporter) Plan(plan Plan) {
+	entries := planEntries(plan)
+
+	reporter.Document.Plan = append(reporter.Document.Plan, entries...)
+	reporter.Document.Summary = plan.Summary
+
+	if reporter.IsStreaming {
+		for _, entry := range entries {
+			reporter.writeLine(entry)
+		}
+		reporter.writeLine(summaryEntry{"summary", plan.Summary})
+	}
+}
+
+func (reporter *JSONReporter) Results(results []Result) {
+	reporter.Document.Applied = true
+	reporter.Document.Results = append(reporter.Document.Results, results...)
+
+	if reporter.IsStreaming {
+		for _, result := range results {
+			reporter.writeLine(resultEntry{"result", result})
+		}
+	}
+}
+
+func (reporter *JSONReporter) Flush() {
+	if reporter.isFlushed || reporter.IsStreaming {
+		return
+	}
+	reporter.isFlushed = true
+
+	content, err := json.MarshalIndent(reporter.Document, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing JSON output:", err)
+		return
+	}
+	fmt.Fprintln(reporter.Out, string(content))
+}
+
+func (reporter *JSONReporter) writeLine(value interface{}) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing NDJSON output:", err)
+		return
+	}
+	fmt.Fprintln(reporter.Out, string(content))
+}
+
+// Flatten the plan to one entry per secret.
+func planEntries(plan Plan) []PlanEntry {
+	entries := []PlanEntry{}
+
+	for _, target := range plan.Targets {
+		for _, secret := range target.Secrets {
+			entries = append(entries, PlanEntry{
+				Type:       "plan",
+				TargetType: target.Type,
+				Target:     target.Name,
+				Env:        target.Env,
+				Secret:     secret.Name,
+				Action:     secret.Action,
+				FromPack:   secret.FromPack,
+				UsedIn:     secret.UsedIn,
+				Unused:     secret.Unused,
+				Warnings:   secret.Warnings,
+			})
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,104 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Writes the plan, and the results if applied, as Markdown tables when flushed. Unchanged secrets are only counted, not
+// listed. Used for the job summary in GitHub Actions.
+type MarkdownReporter struct {
+	Out       io.Writer
+	plan      *Plan
+	results   []Result
+	isApplied bool
+	isFlushed bool
+}
+
+func (reporter *MarkdownReporter) Plan(plan Plan) {
+	reporter.plan = &plan
+}
+
+func (reporter *MarkdownReporter) Results(results []Result) {
+	reporter.isApplied = true
+	reporter.results = append(reporter.results, results...)
+}
+
+// Writes nothing if there's no plan.
+func (reporter *MarkdownReporter) Flush() {
+	if reporter.isFlushed || reporter.plan == nil {
+		return
+	}
+	reporter.isFlushed = true
+
+	out := reporter.Out
+
+	fmt.Fprintln(out, "## gass")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Plan: "+reporter.plan.Summary.String()+".")
+	fmt.Fprintln(out, "")
+
+	unchanged := 0
+	rows := []string{}
+	for _, target := range reporter.plan.Targets {
+		for _, secret := range target.Secrets {
+			if secret.Action == "unchanged" {
+				unchanged++
+				continue
+			}
+
+			notes := append([]string{}, secret.Warnings...)
+			if len(secret.UsedIn) > 0 {
+				notes = append(notes, "used in "+strings.Join(secret.UsedIn, ", "))
+			}
+			if secret.FromPack != "" {
+				notes = append(notes, "from pack "+secret.FromPack)
+			}
+			if secret.Unused {
+				notes = append(notes, "unused")
+			}
+
+			rows = append(rows, markdownRow(target.Type+" "+target.Name, target.Env, secret.Name, secret.Action, strings.Join(notes, "; ")))
+		}
+	}
+
+	if len(rows) > 0 {
+		fmt.Fprintln(out, markdownRow("Target", "Env", "Secret", "Action", "Notes"))
+		fmt.Fprintln(out, markdownRow("---", "---", "---", "---", "---"))
+		for _, row := range rows {
+			fmt.Fprintln(out, row)
+		}
+		fmt.Fprintln(out, "")
+	}
+
+	if unchanged > 0 {
+		fmt.Fprintln(out, pluralize(unchanged, "secret")+" unchanged.")
+		fmt.Fprintln(out, "")
+	}
+
+	if !reporter.isApplied {
+		fmt.Fprintln(out, "Nothing was applied.")
+		return
+	}
+
+	fmt.Fprintln(out, "### Results")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, markdownRow("Target", "Env", "Secret", "Action", "Status"))
+	fmt.Fprintln(out, markdownRow("---", "---", "---", "---", "---"))
+	for _, result := range reporter.results {
+		status := result.Status
+		if result.Error != "" {
+			status += ": " + result.Error
+		}
+		fmt.Fprintln(out, markdownRow(result.TargetType+" "+result.Target, result.Env, result.Secret, result.Action, status))
+	}
+}
+
+func markdownRow(cells ...string) string {
+	escaped := []string{}
+	for _, cell := range cells {
+		escaped = append(escaped, strings.ReplaceAll(strings.ReplaceAll(cell, "|", "\\|"), "\n", " "))
+	}
+	return "| " + strings.Join(escaped, " | ") + " |"
+}
@@ -0,0 +1,115 @@
+// Package report renders plans, and the results of applying them, as text, JSON, or Markdown.
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The changes to be made, grouped by target.
+type Plan struct {
+	Targets []Target
+	Summary Summary
+}
+
+// A repo, an env in a repo, or an org, along with its secrets in the plan. Envs come right after their repo.
+type Target struct {
+	Type    string // "repo" or "org".
+	Name    string
+	Env     string // empty, unless this is an env in a repo.
+	Secrets []Secret
+}
+
+type Secret struct {
+	Name     string
+	Action   string   // "create", "update", "unchanged", "delete", "missing", or "unused" when auditing.
+	FromPack string   // name of the pack this secret came from, empty if specified directly.
+	UsedIn   []string // workflow files using this secret, only for deleted and missing secrets.
+	Unused   bool     // not used by any workflow that can see it. Only known for repo and env secrets that are kept.
+	Warnings []string
+}
+
+// The outcome of a single call made to GitHub, when applying.
+type Result struct {
+	TargetType string `json:"target_type"`
+	Target     string `json:"target"`
+	Env        string `json:"env,omitempty"`
+	Secret     string `json:"secret"`
+	Action     string `json:"action"`
+	Status     string `json:"status"` // "ok" or "error".
+	HttpStatus int    `json:"http_status,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Summary struct {
+	Creates int `json:"creates"`
+	Updates int `json:"updates"`
+	Deletes int `json:"deletes"`
+	Repos   int `json:"repos"` // number of repos with at least one change.
+	Orgs    int `json:"orgs"`  // number of orgs with at least one change.
+}
+
+// Renders a plan, and the results of applying it. Some reporters write everything at once when flushed, so `Flush`
+// has to be called before exiting.
+type Reporter interface {
+	Plan(plan Plan)
+	Results(results []Result)
+	// Write out anything held back till the end. Safe to call more than once, only the first call writes anything.
+	Flush()
+}
+
+// Number of secrets set for deletion, that are used in workflows.
+func (plan Plan) UsedDeletions() int {
+	count := 0
+	for _, target := range plan.Targets {
+		for _, secret := range target.Secrets {
+			if secret.Action == "delete" && len(secret.UsedIn) > 0 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Number of secrets that are kept, but aren't used by any workflow.
+func (plan Plan) UnusedSecrets() int {
+	count := 0
+	for _, target := range plan.Targets {
+		for _, secret := range target.Secrets {
+			if secret.Unused {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (summary Summary) Total() int {
+	return summary.Creates + summary.Updates + summary.Deletes
+}
+
+func (summary Summary) String() string {
+	targets := []string{}
+	if summary.Repos > 0 || summary.Orgs == 0 {
+		targets = append(targets, pluralize(summary.Repos, "repo"))
+	}
+	if summary.Orgs > 0 {
+		targets = append(targets, pluralize(summary.Orgs, "org"))
+	}
+
+	return fmt.Sprintf(
+		"%v create, %v update, %v delete across %v",
+		summary.Creates,
+		summary.Updates,
+		summary.Deletes,
+		strings.Join(targets, " and "),
+	)
+}
+
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(count) + " " + noun + "s"
+}
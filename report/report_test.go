@@ -0,0 +1,151 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+var testPlan = Plan{
+	Targets: []Target{
+		{Type: "org", Name: "acme", Secrets: []Secret{
+			{Name: "ORG_ONE", Action: "update"},
+		}},
+		{Type: "repo", Name: "sharat87/prestige", Secrets: []Secret{
+			{Name: "ONE", Action: "create", FromPack: "aws", Warnings: []string{"expires soon"}},
+			{Name: "TWO", Action: "delete", UsedIn: []string{"build.yml", "deploy.yml"}},
+			{Name: "THREE", Action: "missing", UsedIn: []string{"build.yml"}},
+		}},
+		{Type: "repo", Name: "sharat87/prestige", Env: "production", Secrets: []Secret{
+			{Name: "ONE", Action: "unchanged", Unused: true},
+		}},
+		{Type: "repo", Name: "sharat87/httpbun", Secrets: []Secret{}},
+	},
+	Summary: Summary{Creates: 1, Updates: 1, Deletes: 1, Repos: 1, Orgs: 1},
+}
+
+var testResults = []Result{
+	{TargetType: "repo", Target: "sharat87/prestige", Secret: "ONE", Action: "create", Status: "ok", HttpStatus: 201},
+	{TargetType: "repo", Target: "sharat87/prestige", Secret: "TWO", Action: "delete", Status: "error", HttpStatus: 403, Error: "HTTP 403: Forbidden"},
+}
+
+func TestSummaryString(t *testing.T) {
+	assert.Equal(t, "1 create, 2 update, 2 delete across 1 repo and 1 org", Summary{Creates: 1, Updates: 2, Deletes: 2, Repos: 1, Orgs: 1}.String())
+	assert.Equal(t, "0 create, 0 update, 0 delete across 0 repos", Summary{}.String())
+	assert.Equal(t, 5, Summary{Creates: 1, Updates: 2, Deletes: 2}.Total())
+}
+
+func TestTextReporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	reporter := &TextReporter{Out: out}
+	reporter.Plan(testPlan)
+
+	assert.Equal(t, `org  acme
+	updated	ORG_ONE
+
+repo sharat87/prestige
+	created	ONE (from pack aws)
+		warning: expires soon
+	deleted	TWO (used in 'build.yml', 'deploy.yml')
+	missing	THREE
+	env production
+		unchanged	ONE (unused)
+
+repo sharat87/httpbun
+
+`, out.String())
+}
+
+func TestTextReporterColor(t *testing.T) {
+	out := &bytes.Buffer{}
+	reporter := &TextReporter{Out: out, Style: Style{IsEnabled: true}}
+	reporter.Plan(Plan{Targets: []Target{{Type: "repo", Name: "a/b", Secrets: []Secret{{Name: "ONE", Action: "create"}}}}})
+
+	assert.Equal(t, "\033[1mrepo a/b\033[0m\n\t\033[32mcreated\tONE\033[0m\n\n", out.String())
+}
+
+func TestJSONReporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	reporter := NewJSONReporter(out, false, "v1")
+
+	reporter.Plan(testPlan)
+	reporter.Results(testResults)
+	assert.Empty(t, out.String())
+
+	reporter.Flush()
+	reporter.Flush()
+
+	document := Document{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &document))
+	assert.Equal(t, "v1", document.GassVersion)
+	assert.Len(t, document.Plan, 5)
+	assert.Equal(t, PlanEntry{
+		Type:       "plan",
+		TargetType: "repo",
+		Target:     "sharat87/prestige",
+		Secret:     "TWO",
+		Action:     "delete",
+		UsedIn:     []string{"build.yml", "deploy.yml"},
+	}, document.Plan[2])
+	assert.True(t, document.Plan[4].Unused)
+	assert.Equal(t, testPlan.Summary, document.Summary)
+	assert.True(t, document.Applied)
+	assert.Equal(t, testResults, document.Results)
+}
+
+func TestJSONReporterStreaming(t *testing.T) {
+	out := &bytes.Buffer{}
+	reporter := NewJSONReporter(out, true, "v1")
+
+	reporter.Plan(testPlan)
+	reporter.Results(testResults)
+	reporter.Flush()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 8)
+	assert.Equal(t, `{"type":"plan","target_type":"org","target":"acme","secret":"ORG_ONE","action":"update"}`, lines[0])
+	assert.Equal(t, `{"type":"summary","creates":1,"updates":1,"deletes":1,"repos":1,"orgs":1}`, lines[5])
+	assert.Equal(t, `{"type":"result","target_type":"repo","target":"sharat87/prestige","secret":"TWO","action":"delete","status":"error","http_status":403,"error":"HTTP 403: Forbidden"}`, lines[7])
+}
+
+func TestMarkdownReporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	reporter := &MarkdownReporter{Out: out}
+
+	reporter.Flush()
+	assert.Empty(t, out.String())
+
+	reporter.Plan(testPlan)
+	reporter.Results(testResults[1:])
+	reporter.Flush()
+
+	assert.Equal(t, `## gass
+
+Plan: 1 create, 1 update, 1 delete across 1 repo and 1 org.
+
+| Target | Env | Secret | Action | Notes |
+| --- | --- | --- | --- | --- |
+| org acme |  | ORG_ONE | update |  |
+| repo sharat87/prestige |  | ONE | create | expires soon; from pack aws |
+| repo sharat87/prestige |  | TWO | delete | used in build.yml, deploy.yml |
+| repo sharat87/prestige |  | THREE | missing | used in build.yml |
+
+1 secret unchanged.
+
+### Results
+
+| Target | Env | Secret | Action | Status |
+| --- | --- | --- | --- | --- |
+| repo sharat87/prestige |  | TWO | delete | error: HTTP 403: Forbidden |
+`, out.String())
+}
+
+func TestUsedDeletions(t *testing.T) {
+	assert.Equal(t, 1, testPlan.UsedDeletions())
+}
+
+func TestUnusedSecrets(t *testing.T) {
+	assert.Equal(t, 1, testPlan.UnusedSecrets())
+}
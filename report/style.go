@@ -0,0 +1,49 @@
+package report
+
+// Styles codes from <https://stackoverflow.com/a/33206814/151048>.
+const (
+	styleReset   = "\033[0m"
+	styleRed     = "\033[31m"
+	styleGreen   = "\033[32m"
+	styleYellow  = "\033[33m"
+	styleBlue    = "\033[34m"
+	styleBold    = "\033[1m"
+	styleReverse = "\033[7m"
+)
+
+// Wraps text in ANSI escape codes, only if enabled. The zero value doesn't style anything.
+type Style struct {
+	IsEnabled bool
+}
+
+func (style Style) Red(text string) string {
+	return style.wrap(styleRed, text)
+}
+
+func (style Style) Green(text string) string {
+	return style.wrap(styleGreen, text)
+}
+
+func (style Style) Yellow(text string) string {
+	return style.wrap(styleYellow, text)
+}
+
+func (style Style) Blue(text string) string {
+	return style.wrap(styleBlue, text)
+}
+
+func (style Style) Bold(text string) string {
+	return style.wrap(styleBold, text)
+}
+
+// Bold and reversed, to stand out even within colored text.
+func (style Style) Highlight(text string) string {
+	return style.wrap(styleBold+styleReverse, text)
+}
+
+func (style Style) wrap(code, text string) string {
+	if !style.IsEnabled {
+		return text
+	}
+	return code + text + styleReset
+}
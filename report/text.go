@@ -0,0 +1,78 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Renders the plan for humans, one line per secret, grouped by target.
+type TextReporter struct {
+	Out   io.Writer
+	Style Style
+}
+
+func (reporter *TextReporter) Plan(plan Plan) {
+	style := reporter.Style
+
+	for i, target := range plan.Targets {
+		indent := "\t"
+		if target.Env != "" {
+			fmt.Fprintln(reporter.Out, "\t"+style.Bold("env "+target.Env))
+			indent = "\t\t"
+		} else if target.Type == "org" {
+			fmt.Fprintln(reporter.Out, style.Bold("org  "+target.Name))
+		} else {
+			fmt.Fprintln(reporter.Out, style.Bold("repo "+target.Name))
+		}
+
+		for _, secret := range target.Secrets {
+			fmt.Fprintln(reporter.Out, indent+reporter.secretLine(secret))
+			for _, warning := range secret.Warnings {
+				fmt.Fprintln(reporter.Out, indent+"\t"+style.Yellow("warning: "+warning))
+			}
+		}
+
+		// Envs are shown within their repo, so the blank line comes after the last of them.
+		if i+1 == len(plan.Targets) || plan.Targets[i+1].Env == "" {
+			fmt.Fprintln(reporter.Out, "")
+		}
+	}
+}
+
+func (reporter *TextReporter) secretLine(secret Secret) string {
+	style := reporter.Style
+
+	fromPack := ""
+	if secret.FromPack != "" {
+		fromPack = " (from pack " + secret.FromPack + ")"
+	}
+	unused := ""
+	if secret.Unused {
+		unused = " " + style.Highlight("(unused)")
+	}
+
+	switch secret.Action {
+	case "delete":
+		line := style.Red("deleted\t" + secret.Name)
+		if len(secret.UsedIn) > 0 {
+			line += " " + style.Highlight("(used in '"+strings.Join(secret.UsedIn, "', '")+"')")
+		}
+		return line
+	case "create":
+		return style.Green("created\t"+secret.Name+fromPack) + unused
+	case "update":
+		return style.Blue("updated\t"+secret.Name+fromPack) + unused
+	case "missing":
+		return style.Yellow("missing\t" + secret.Name)
+	default:
+		return secret.Action + "\t" + secret.Name + fromPack + unused
+	}
+}
+
+// Errors are already logged as they happen, so there's nothing more to show here.
+func (reporter *TextReporter) Results(results []Result) {
+}
+
+func (reporter *TextReporter) Flush() {
+}
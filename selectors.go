@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sharat87/gass/github"
+	"path"
+	"strings"
+)
+
+// A RepoSelector applies its secrets (and packs, envs etc.) to all repos of an org that match its criteria. The matching
+// repos are resolved with the GitHub API, every time a sync is run.
+type RepoSelector struct {
+	Org             string
+	Topic           string
+	ExcludeArchived bool   `yaml:"exclude_archived"`
+	NameGlob        string `yaml:"name_glob"`
+	SyncSpecRepo    `yaml:",inline"`
+}
+
+func (rs RepoSelector) String() string {
+	parts := []string{"org " + rs.Org}
+	if rs.Topic != "" {
+		parts = append(parts, "topic "+rs.Topic)
+	}
+	if rs.NameGlob != "" {
+		parts = append(parts, "name "+rs.NameGlob)
+	}
+	if rs.ExcludeArchived {
+		parts = append(parts, "not archived")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (rs RepoSelector) Matches(repo github.Repo) (bool, error) {
+	if rs.ExcludeArchived && repo.Archived {
+		return false, nil
+	}
+
+	if rs.NameGlob != "" {
+		isMatch, err := path.Match(rs.NameGlob, repo.Name)
+		if err != nil {
+			return false, &ConfigError{fmt.Sprintf("Invalid `name_glob` '%v': %v", rs.NameGlob, err)}
+		}
+		if !isMatch {
+			return false, nil
+		}
+	}
+
+	if rs.Topic != "" {
+		hasTopic := false
+		for _, topic := range repo.Topics {
+			if topic == rs.Topic {
+				hasTopic = true
+				break
+			}
+		}
+		if !hasTopic {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Resolve the given selectors into specs for concrete repos, merged with the explicitly listed repos. Selectors are
+// merged in order, and explicitly listed repos take precedence over all selectors. The packs are those the specs may use,
+// to tell which secrets they provide. The second return value lists the full names of repos matched by each selector, in
+// the same order as the selectors.
+func expandRepoSelectors(selectors []RepoSelector, repos map[string]SyncSpecRepo, packs map[string]SecretPack, fetchOrgRepos func(string) ([]github.Repo, error)) (map[string]SyncSpecRepo, [][]string, error) {
+	expanded := map[string]SyncSpecRepo{}
+	matchesBySelector := [][]string{}
+
+	for _, selector := range selectors {
+		if selector.Org == "" {
+			return nil, nil, &ConfigError{"Repo selector is missing `org`"}
+		}
+
+		orgRepos, err := fetchOrgRepos(selector.Org)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		matches := []string{}
+		for _, repo := range orgRepos {
+			isMatch, err := selector.Matches(repo)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !isMatch {
+				continue
+			}
+
+			fullName := repo.FullName
+			if fullName == "" {
+				fullName = selector.Org + "/" + repo.Name
+			}
+
+			matches = append(matches, fullName)
+			expanded[fullName] = mergeRepoSpecs(expanded[fullName], selector.SyncSpecRepo, packs)
+		}
+
+		matchesBySelector = append(matchesBySelector, matches)
+	}
+
+	for name, spec := range repos {
+		expanded[name] = mergeRepoSpecs(expanded[name], spec, packs)
+	}
+
+	return expanded, matchesBySelector, nil
+}
+
+// Merge two repo specs, with everything in `override` taking precedence over `base`. So `delete_unspecified` is taken
+// from `override`, unless it isn't given there, and its secrets, whether given directly or from its packs, win over all secrets of `base`. Packs are
+// concatenated, so those of `override` win over those of `base`. The `local_path` of `base` is kept, unless `override`
+// has one.
+func mergeRepoSpecs(base, override SyncSpecRepo, packs map[string]SecretPack) SyncSpecRepo {
+	merged := SyncSpecRepo{
+		Delete:    base.Delete,
+		UsePacks:  append(append([]string{}, base.UsePacks...), override.UsePacks...),
+		Secrets:   mergeSecretSpecs(base.Secrets, override.Secrets, packSecretNames(packs, override.UsePacks)),
+		LocalPath: base.LocalPath,
+	}
+
+	if override.Delete != nil {
+		merged.Delete = override.Delete
+	}
+
+	if override.LocalPath != "" {
+		merged.LocalPath = override.LocalPath
+	}
+
+	if len(merged.UsePacks) == 0 {
+		merged.UsePacks = nil
+	}
+
+	if base.Envs != nil || override.Envs != nil {
+		merged.Envs = map[string]SecretPack{}
+		for name, pack := range base.Envs {
+			merged.Envs[name] = pack
+		}
+		for name, pack := range override.Envs {
+			basePack := merged.Envs[name]
+			merged.Envs[name] = SecretPack{
+				UsePacks: append(append([]string{}, basePack.UsePacks...), pack.UsePacks...),
+				Secrets:  mergeSecretSpecs(basePack.Secrets, pack.Secrets, packSecretNames(packs, pack.UsePacks)),
+			}
+		}
+	}
+
+	return merged
+}
+
+// Merge secrets given directly, with those in `override` taking precedence. Secrets of `base` named in `fromOverridePacks`
+// are dropped, so that the ones from the packs of `override` are used instead.
+func mergeSecretSpecs(base, override map[string]SecretValueSpec, fromOverridePacks map[string]bool) map[string]SecretValueSpec {
+	if base == nil && override == nil {
+		return nil
+	}
+
+	merged := map[string]SecretValueSpec{}
+	for name, valueSpec := range base {
+		if !fromOverridePacks[name] {
+			merged[name] = valueSpec
+		}
+	}
+	for name, valueSpec := range override {
+		merged[name] = valueSpec
+	}
+
+	return merged
+}
+
+// Names of the secrets in the given packs. Unknown packs are skipped, since they're reported when the packs are resolved.
+func packSecretNames(packs map[string]SecretPack, usePacks []string) map[string]bool {
+	names := map[string]bool{}
+	for _, packName := range usePacks {
+		for name := range packs[packName].Secrets {
+			names[name] = true
+		}
+	}
+	return names
+}
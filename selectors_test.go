@@ -0,0 +1,168 @@
+package main
+
+import (
+	"github.com/sharat87/gass/github"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRepoSelectors(t *testing.T) {
+	spec := SyncSpec{}
+	err := yaml.UnmarshalStrict([]byte(`
+repo_selectors:
+  - org: acme
+    topic: deploys-to-aws
+    exclude_archived: true
+    name_glob: "svc-*"
+    use_packs: [aws]
+    secrets:
+      ONE:
+        value: one
+`), &spec)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []RepoSelector{{
+		Org:             "acme",
+		Topic:           "deploys-to-aws",
+		ExcludeArchived: true,
+		NameGlob:        "svc-*",
+		SyncSpecRepo: SyncSpecRepo{
+			UsePacks: []string{"aws"},
+			Secrets:  map[string]SecretValueSpec{"ONE": {Value: "one"}},
+		},
+	}}, spec.RepoSelectors)
+}
+
+func TestExpandRepoSelectors(t *testing.T) {
+	fetchOrgRepos := func(org string) ([]github.Repo, error) {
+		return []github.Repo{
+			{Name: "svc-one", FullName: "acme/svc-one", Topics: []string{"deploys-to-aws"}},
+			{Name: "svc-two", FullName: "acme/svc-two", Topics: []string{"deploys-to-aws"}, Archived: true},
+			{Name: "svc-three", FullName: "acme/svc-three"},
+			{Name: "website", FullName: "acme/website", Topics: []string{"deploys-to-aws"}},
+		}, nil
+	}
+
+	selectors := []RepoSelector{{
+		Org:             "acme",
+		Topic:           "deploys-to-aws",
+		ExcludeArchived: true,
+		NameGlob:        "svc-*",
+		SyncSpecRepo: SyncSpecRepo{
+			Secrets: map[string]SecretValueSpec{
+				"ONE": {Value: "from-selector"},
+				"TWO": {Value: "from-selector"},
+			},
+		},
+	}}
+
+	repos, matches, err := expandRepoSelectors(selectors, map[string]SyncSpecRepo{
+		"acme/svc-one": {Secrets: map[string]SecretValueSpec{"ONE": {Value: "explicit"}}},
+	}, nil, fetchOrgRepos)
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"acme/svc-one"}}, matches)
+	assert.Equal(t, map[string]SyncSpecRepo{
+		"acme/svc-one": {Secrets: map[string]SecretValueSpec{
+			"ONE": {Value: "explicit"},
+			"TWO": {Value: "from-selector"},
+		}},
+	}, repos)
+}
+
+func TestExpandRepoSelectorsExplicitRepoWins(t *testing.T) {
+	fetchOrgRepos := func(org string) ([]github.Repo, error) {
+		return []github.Repo{{Name: "api", FullName: "acme/api"}, {Name: "web", FullName: "acme/web"}}, nil
+	}
+
+	selectors := []RepoSelector{{
+		Org: "acme",
+		SyncSpecRepo: SyncSpecRepo{
+			Delete: boolPtr(true),
+			Secrets: map[string]SecretValueSpec{
+				"AWS_KEY": {Value: "from-selector"},
+				"OTHER":   {Value: "from-selector"},
+			},
+			Envs: map[string]SecretPack{
+				"production": {Secrets: map[string]SecretValueSpec{"AWS_KEY": {Value: "from-selector"}}},
+			},
+		},
+	}}
+
+	packs := map[string]SecretPack{
+		"aws": {Secrets: map[string]SecretValueSpec{"AWS_KEY": {Value: "from-pack"}}},
+	}
+
+	repos, _, err := expandRepoSelectors(selectors, map[string]SyncSpecRepo{
+		"acme/api": {
+			UsePacks: []string{"aws"},
+			Envs:     map[string]SecretPack{"production": {UsePacks: []string{"aws"}}},
+		},
+	}, packs, fetchOrgRepos)
+
+	assert.NoError(t, err)
+
+	// The explicit entry doesn't give `delete_unspecified`, so the selector's is kept, and its pack wins over the
+	// selector's secret of the same name.
+	assert.Equal(t, SyncSpecRepo{
+		Delete:   boolPtr(true),
+		UsePacks: []string{"aws"},
+		Secrets:  map[string]SecretValueSpec{"OTHER": {Value: "from-selector"}},
+		Envs: map[string]SecretPack{
+			"production": {UsePacks: []string{"aws"}, Secrets: map[string]SecretValueSpec{}},
+		},
+	}, repos["acme/api"])
+
+	resolved, fromPacks, err := resolveSecrets(packs, repos["acme/api"].UsePacks, repos["acme/api"].Secrets)
+	assert.NoError(t, err)
+	assert.Equal(t, SecretValueSpec{Value: "from-pack"}, resolved["AWS_KEY"])
+	assert.Equal(t, map[string]string{"AWS_KEY": "aws"}, fromPacks)
+
+	assert.True(t, repos["acme/web"].DeletesUnspecified())
+}
+
+func TestExpandRepoSelectorsDeleteUnspecified(t *testing.T) {
+	fetchOrgRepos := func(org string) ([]github.Repo, error) {
+		return []github.Repo{{Name: "api", FullName: "acme/api"}, {Name: "web", FullName: "acme/web"}}, nil
+	}
+
+	selectors := []RepoSelector{{Org: "acme", SyncSpecRepo: SyncSpecRepo{Delete: boolPtr(true)}}}
+
+	repos, _, err := expandRepoSelectors(selectors, map[string]SyncSpecRepo{
+		"acme/api": {Delete: boolPtr(false)},
+		"acme/web": {Secrets: map[string]SecretValueSpec{"ONE": {Value: "one"}}},
+	}, nil, fetchOrgRepos)
+
+	assert.NoError(t, err)
+	assert.False(t, repos["acme/api"].DeletesUnspecified())
+	assert.True(t, repos["acme/web"].DeletesUnspecified())
+}
+
+func TestExpandRepoSelectorsKeepsLocalPath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "secrets.yml")
+	assert.NoError(t, os.WriteFile(file, []byte(`
+repos:
+  acme/api:
+    local_path: ../api
+repo_selectors:
+  - org: acme
+    secrets:
+      ONE:
+        value: one
+`), 0600))
+
+	spec, _, err := loadConfig(file, "")
+	assert.NoError(t, err)
+
+	repos, _, err := expandRepoSelectors(spec.RepoSelectors, spec.Repos, nil, func(org string) ([]github.Repo, error) {
+		return []github.Repo{{Name: "api", FullName: "acme/api"}}, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "..", "api"), repos["acme/api"].LocalPath)
+	assert.Equal(t, map[string]SecretValueSpec{"ONE": {Value: "one"}}, repos["acme/api"].Secrets)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sharat87/gass/github"
+	"strings"
+)
+
+// The secrets defined for a repo at each level, by upper cased name, since secret names are case insensitive. Env
+// secrets win over repo secrets, which win over org secrets of the same name.
+type secretLevels struct {
+	Org  map[string]bool
+	Repo map[string]bool
+	Envs map[string]map[string]bool // by env name.
+}
+
+func newSecretLevels() secretLevels {
+	return secretLevels{Org: map[string]bool{}, Repo: map[string]bool{}, Envs: map[string]map[string]bool{}}
+}
+
+// The secrets of a repo once the plan is applied. Org secrets are those the repo can see on GitHub now, along with the
+// ones the plan creates or updates with a visibility that covers the repo, and without the ones it deletes, or makes
+// invisible to the repo. Envs that aren't in the config have their secrets as they are on GitHub now.
+func plannedSecretLevels(repo QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg) secretLevels {
+	levels := newSecretLevels()
+
+	for _, name := range repo.OrgSecrets {
+		levels.Org[strings.ToUpper(name)] = true
+	}
+
+	for _, org := range allChangesForOrgs {
+		if !strings.EqualFold(org.OrgName, repoOwner(repo.FullRepoName)) {
+			continue
+		}
+
+		for _, call := range org.Calls {
+			name := strings.ToUpper(call.SecretName)
+			if call.Call == "delete" {
+				delete(levels.Org, name)
+			} else if call.Call != "create" && call.Call != "update" {
+				continue
+			} else if repo.Repo.Id == 0 && (call.OrgVisibility == "private" || call.OrgVisibility == "selected") {
+				// Without knowing the repo, which of these it can see is unknown, so they're left as they are now.
+				continue
+			} else if canSeeOrgSecret(repo.Repo, call.OrgVisibility, call.OrgRepoIds) {
+				levels.Org[name] = true
+			} else {
+				delete(levels.Org, name)
+			}
+		}
+	}
+
+	addNames(levels.Repo, sortedKeys(specifiedNames(repo.Calls)), repo.UnmanagedSecrets)
+
+	for envName, env := range repo.Envs {
+		levels.Envs[envName] = map[string]bool{}
+		addNames(levels.Envs[envName], sortedKeys(specifiedNames(env.Calls)), env.UnmanagedSecrets)
+	}
+
+	for envName, names := range repo.OtherEnvSecrets {
+		levels.Envs[envName] = map[string]bool{}
+		addNames(levels.Envs[envName], names)
+	}
+
+	return levels
+}
+
+// Set the repo on GitHub, with its id and visibility, of repos whose org has secrets that the plan creates or updates,
+// that only some repos can see, so it can be told if the repo will see them.
+func fillOrgRepos(allChanges []QualifiedSecretCallsByRepo, allChangesForOrgs []QualifiedSecretCallsByOrg, fetchOrgRepos func(org string) ([]github.Repo, error)) error {
+	for i, repo := range allChanges {
+		if !hasLimitedOrgSecretChanges(repoOwner(repo.FullRepoName), allChangesForOrgs) {
+			continue
+		}
+
+		orgRepos, err := fetchOrgRepos(repoOwner(repo.FullRepoName))
+		if err != nil {
+			return err
+		}
+
+		for _, orgRepo := range orgRepos {
+			if strings.EqualFold(orgRepo.FullName, repo.FullRepoName) {
+				allChanges[i].Repo = orgRepo
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasLimitedOrgSecretChanges(orgName string, allChangesForOrgs []QualifiedSecretCallsByOrg) bool {
+	for _, org := range allChangesForOrgs {
+		if !strings.EqualFold(org.OrgName, orgName) {
+			continue
+		}
+		for _, call := range org.Calls {
+			if (call.Call == "create" || call.Call == "update") && (call.OrgVisibility == "private" || call.OrgVisibility == "selected") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func addNames(set map[string]bool, lists ...[]string) {
+	for _, names := range lists {
+		for _, name := range names {
+			set[strings.ToUpper(name)] = true
+		}
+	}
+}
+
+// The level a secret's value comes from, for jobs in the given env, or outside of envs if it's empty. One of "env",
+// "repo" or "org", or empty if the secret isn't defined at any level the job can see.
+func (levels secretLevels) source(secretName, envName string) string {
+	name := strings.ToUpper(secretName)
+
+	if envName != "" && levels.envSecrets(envName)[name] {
+		return "env"
+	} else if levels.Repo[name] {
+		return "repo"
+	} else if levels.Org[name] {
+		return "org"
+	}
+	return ""
+}
+
+// If the secret may resolve for the usage. When the usage's env is only known at runtime, any env having the secret
+// could be the one it comes from.
+func (levels secretLevels) resolves(secretName string, usage github.SecretUsage) bool {
+	if levels.source(secretName, usage.Environment) != "" {
+		return true
+	}
+	if usage.IsDynamicEnvironment() {
+		for _, secrets := range levels.Envs {
+			if secrets[strings.ToUpper(secretName)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The secrets of the given env, whose name is case insensitive.
+func (levels secretLevels) envSecrets(envName string) map[string]bool {
+	for name, secrets := range levels.Envs {
+		if strings.EqualFold(name, envName) {
+			return secrets
+		}
+	}
+	return nil
+}
+
+// The levels that define the secret, but lose to the one it comes from, for jobs in the given env.
+func (levels secretLevels) shadowed(secretName, envName string) []string {
+	name := strings.ToUpper(secretName)
+	source := levels.source(secretName, envName)
+
+	shadowed := []string{}
+	if source == "env" && levels.Repo[name] {
+		shadowed = append(shadowed, "repo")
+	}
+	if (source == "env" || source == "repo") && levels.Org[name] {
+		shadowed = append(shadowed, "org")
+	}
+	return shadowed
+}
+
+// Warnings for a secret that overrides secrets of the same name at lower levels. For a repo secret, the env name is
+// empty.
+func overrideWarnings(levels secretLevels, envName, secretName string) []string {
+	warnings := []string{}
+	for _, level := range levels.shadowed(secretName, envName) {
+		warnings = append(warnings, "Overrides the "+level+" secret with the same name")
+	}
+	return warnings
+}
+
+// Warnings for an org secret that's shadowed in some of the org's repos, by a repo secret, or by env secrets where the
+// repo doesn't have one, so updating the org secret has no effect there.
+func orgShadowedWarnings(orgName, secretName string, allChanges []QualifiedSecretCallsByRepo) []string {
+	warnings := []string{}
+
+	for _, repo := range allChanges {
+		if !strings.EqualFold(repoOwner(repo.FullRepoName), orgName) {
+			continue
+		}
+
+		levels := plannedSecretLevels(repo, nil)
+		if !levels.Org[strings.ToUpper(secretName)] {
+			continue
+		}
+
+		if levels.source(secretName, "") == "repo" {
+			warnings = append(warnings, fmt.Sprintf("Shadowed by the repo secret in '%v'", repo.FullRepoName))
+			continue
+		}
+
+		for _, envName := range sortedKeys(levels.Envs) {
+			if levels.source(secretName, envName) == "env" {
+				warnings = append(warnings, fmt.Sprintf("Shadowed by the secret of env '%v' in '%v'", envName, repo.FullRepoName))
+			}
+		}
+	}
+
+	return warnings
+}
+
+func repoOwner(fullRepoName string) string {
+	owner, _, _ := strings.Cut(fullRepoName, "/")
+	return owner
+}
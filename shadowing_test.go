@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/sharat87/gass/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecretLevelsSource(t *testing.T) {
+	levels := newSecretLevels()
+	addNames(levels.Org, []string{"NPM_TOKEN", "SENTRY_DSN"})
+	addNames(levels.Repo, []string{"npm_token"})
+	levels.Envs["Production"] = map[string]bool{}
+	addNames(levels.Envs["Production"], []string{"NPM_TOKEN", "SENTRY_DSN"})
+
+	assert.Equal(t, "repo", levels.source("NPM_TOKEN", ""))
+	assert.Equal(t, []string{"org"}, levels.shadowed("NPM_TOKEN", ""))
+
+	assert.Equal(t, "env", levels.source("npm_token", "production"))
+	assert.Equal(t, []string{"repo", "org"}, levels.shadowed("npm_token", "production"))
+
+	assert.Equal(t, "org", levels.source("SENTRY_DSN", "staging"))
+	assert.Empty(t, levels.shadowed("SENTRY_DSN", "staging"))
+	assert.Equal(t, []string{"org"}, levels.shadowed("SENTRY_DSN", "production"))
+
+	assert.Equal(t, "", levels.source("MISSING", ""))
+}
+
+func TestPlannedSecretLevels(t *testing.T) {
+	repo := QualifiedSecretCallsByRepo{
+		FullRepoName: "acme/api",
+		Calls: []QualifiedSecretCall{
+			{Call: "update", SecretName: "NPM_TOKEN"},
+			{Call: "delete", SecretName: "OLD_KEY"},
+		},
+		UnmanagedSecrets: []string{"LEFTOVER"},
+		OrgSecrets:       []string{"NPM_TOKEN", "RETIRED"},
+		Envs: map[string]QualifiedSecretCallsByRepoEnv{
+			"production": {Calls: []QualifiedSecretCall{{Call: "create", SecretName: "DEPLOY_KEY"}}},
+		},
+	}
+	orgs := []QualifiedSecretCallsByOrg{{OrgName: "acme", Calls: []QualifiedSecretCall{{Call: "delete", SecretName: "RETIRED"}}}}
+
+	levels := plannedSecretLevels(repo, orgs)
+
+	assert.Equal(t, map[string]bool{"NPM_TOKEN": true}, levels.Org)
+	assert.Equal(t, map[string]bool{"NPM_TOKEN": true, "LEFTOVER": true}, levels.Repo)
+	assert.Equal(t, map[string]map[string]bool{"production": {"DEPLOY_KEY": true}}, levels.Envs)
+}
+
+func TestPlannedSecretLevelsWithOrgChanges(t *testing.T) {
+	repo := QualifiedSecretCallsByRepo{
+		FullRepoName: "acme/api",
+		Calls:        []QualifiedSecretCall{},
+		OrgSecrets:   []string{"NPM_TOKEN", "SENTRY_DSN"},
+		Repo:         github.Repo{Id: 1, FullName: "acme/api", Private: false},
+	}
+	orgs := []QualifiedSecretCallsByOrg{{OrgName: "acme", Calls: []QualifiedSecretCall{
+		{Call: "create", SecretName: "DEPLOY_KEY", OrgVisibility: "all"},
+		{Call: "create", SecretName: "SELECTED_KEY", OrgVisibility: "selected", OrgRepoIds: []int{1, 5}},
+		{Call: "create", SecretName: "PRIVATE_KEY", OrgVisibility: "private"},
+		{Call: "update", SecretName: "NPM_TOKEN", OrgVisibility: "selected", OrgRepoIds: []int{5}},
+		{Call: "update", SecretName: "SENTRY_DSN", OrgVisibility: "private"},
+	}}}
+
+	// New org secrets the repo will see are added, and those it won't see anymore are removed.
+	assert.Equal(t, map[string]bool{"DEPLOY_KEY": true, "SELECTED_KEY": true}, plannedSecretLevels(repo, orgs).Org)
+
+	// Without knowing the repo, secrets only some repos see are left as they are now.
+	repo.Repo = github.Repo{}
+	assert.Equal(t, map[string]bool{"DEPLOY_KEY": true, "NPM_TOKEN": true, "SENTRY_DSN": true}, plannedSecretLevels(repo, orgs).Org)
+}
+
+func TestFillOrgRepos(t *testing.T) {
+	allChanges := []QualifiedSecretCallsByRepo{{FullRepoName: "acme/api"}, {FullRepoName: "sharat87/prestige"}}
+	orgs := []QualifiedSecretCallsByOrg{{OrgName: "acme", Calls: []QualifiedSecretCall{
+		{Call: "create", SecretName: "PRIVATE_KEY", OrgVisibility: "private"},
+	}}}
+
+	fetched := []string{}
+	err := fillOrgRepos(allChanges, orgs, func(org string) ([]github.Repo, error) {
+		fetched = append(fetched, org)
+		return []github.Repo{{Id: 1, FullName: "acme/api", Private: true}}, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, github.Repo{Id: 1, FullName: "acme/api", Private: true}, allChanges[0].Repo)
+	assert.Equal(t, github.Repo{}, allChanges[1].Repo)
+	assert.Equal(t, []string{"acme"}, fetched)
+}
+
+func TestOrgShadowedWarnings(t *testing.T) {
+	allChanges := []QualifiedSecretCallsByRepo{
+		{
+			FullRepoName: "acme/api",
+			Calls:        []QualifiedSecretCall{{Call: "unchanged", SecretName: "NPM_TOKEN"}},
+			OrgSecrets:   []string{"NPM_TOKEN", "SENTRY_DSN"},
+			Envs: map[string]QualifiedSecretCallsByRepoEnv{
+				"production": {Calls: []QualifiedSecretCall{{Call: "unchanged", SecretName: "SENTRY_DSN"}}},
+			},
+		},
+		{
+			FullRepoName: "acme/web",
+			Calls:        []QualifiedSecretCall{{Call: "unchanged", SecretName: "SENTRY_DSN"}},
+		},
+		{
+			FullRepoName: "other/api",
+			Calls:        []QualifiedSecretCall{{Call: "unchanged", SecretName: "NPM_TOKEN"}},
+			OrgSecrets:   []string{"NPM_TOKEN"},
+		},
+	}
+
+	assert.Equal(t, []string{"Shadowed by the repo secret in 'acme/api'"}, orgShadowedWarnings("acme", "NPM_TOKEN", allChanges))
+	// The repo that can't see the org secret doesn't shadow it.
+	assert.Equal(t, []string{"Shadowed by the secret of env 'production' in 'acme/api'"}, orgShadowedWarnings("acme", "SENTRY_DSN", allChanges))
+	assert.Empty(t, orgShadowedWarnings("acme", "OTHER", allChanges))
+}
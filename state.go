@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// The state file records what was last pushed to each secret, so that secrets with unchanged values can be skipped.
+// Values are never stored, only a salted HMAC of them, along with GitHub's `updated_at` for the secret as of that push.
+type State struct {
+	Salt    string                            `json:"salt"`
+	Targets map[string]map[string]SecretState `json:"targets"`
+}
+
+type SecretState struct {
+	ValueHmac string `json:"value_hmac"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Load the state file, or start a fresh state, with a new salt, if the file doesn't exist yet.
+func loadState(filename string) (*State, error) {
+	content, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		salt := make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		return &State{
+			Salt:    base64.StdEncoding.EncodeToString(salt),
+			Targets: map[string]map[string]SecretState{},
+		}, nil
+
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, err
+	}
+
+	if state.Salt == "" {
+		return nil, errors.New("State file is missing the salt")
+	}
+
+	if state.Targets == nil {
+		state.Targets = map[string]map[string]SecretState{}
+	}
+
+	return state, nil
+}
+
+func (state *State) Save(filename string) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, content, 0600)
+}
+
+func (state *State) Hmac(value string) string {
+	if state == nil {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(state.Salt))
+	mac.Write([]byte(value))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (state *State) Set(targetKey, secretName string, secretState SecretState) {
+	if state.Targets[targetKey] == nil {
+		state.Targets[targetKey] = map[string]SecretState{}
+	}
+	state.Targets[targetKey][secretName] = secretState
+}
+
+func (state *State) Delete(targetKey, secretName string) {
+	delete(state.Targets[targetKey], secretName)
+	if len(state.Targets[targetKey]) == 0 {
+		delete(state.Targets, targetKey)
+	}
+}
+
+func stateKeyForRepo(fullRepoName string) string {
+	return "repo:" + fullRepoName
+}
+
+func stateKeyForEnv(fullRepoName, envName string) string {
+	return "repo:" + fullRepoName + ":env:" + envName
+}
+
+func stateKeyForOrg(orgName string) string {
+	return "org:" + orgName
+}
+
+// Decide if a secret needs to be created, updated, or can be left alone since it's unchanged since the last push.
+// Secrets that were changed on GitHub since the last push, are updated, along with a warning about the drift.
+func classifyCall(state *State, targetKey, name, valueHmac string, existingSecrets map[string]string) (string, []string) {
+	updatedAt, isExisting := existingSecrets[name]
+	if !isExisting {
+		return "create", nil
+	}
+
+	if state == nil {
+		return "update", nil
+	}
+
+	previous, isKnown := state.Targets[targetKey][name]
+	if !isKnown {
+		return "update", nil
+	}
+
+	if previous.UpdatedAt != updatedAt {
+		return "update", []string{"Changed outside of gass since the last sync, updated at " + updatedAt}
+	}
+
+	if previous.ValueHmac == valueHmac {
+		return "unchanged", nil
+	}
+
+	return "update", nil
+}
+
+func (result AppliedCall) StateKey() string {
+	if result.TargetType == "org" {
+		return stateKeyForOrg(result.Target)
+	} else if result.EnvName != "" {
+		return stateKeyForEnv(result.Target, result.EnvName)
+	}
+	return stateKeyForRepo(result.Target)
+}
+
+// Record the successful calls in the state. Since GitHub doesn't return the new `updated_at` times on saving secrets,
+// they are fetched again, for all targets that had secrets saved.
+func updateState(state *State, results []AppliedCall) {
+	type Target struct {
+		Type    string
+		Name    string
+		EnvName string
+	}
+
+	savedByTarget := map[Target][]AppliedCall{}
+
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+
+		if result.Call.Call == "delete" {
+			state.Delete(result.StateKey(), result.Call.SecretName)
+		} else {
+			target := Target{result.TargetType, result.Target, result.EnvName}
+			savedByTarget[target] = append(savedByTarget[target], result)
+		}
+	}
+
+	for target, saved := range savedByTarget {
+		var existingSecrets map[string]string
+		var err error
+		if target.Type == "org" {
+			existingSecrets, err = getSecretListForOrg(target.Name)
+		} else if target.EnvName != "" {
+			existingSecrets, err = getSecretListForEnv(target.Name, target.EnvName)
+		} else {
+			existingSecrets, err = getSecretList(target.Name)
+		}
+
+		for _, result := range saved {
+			if err != nil {
+				// Forget these secrets, so they are pushed again on the next run.
+				state.Delete(result.StateKey(), result.Call.SecretName)
+				continue
+			}
+
+			state.Set(result.StateKey(), result.Call.SecretName, SecretState{
+				ValueHmac: result.Call.ValueHmac,
+				UpdatedAt: existingSecrets[result.Call.SecretName],
+			})
+		}
+
+		if err != nil {
+			log.Printf("Error fetching secrets of %v %v to update the state: %v", target.Type, target.Name, err)
+		}
+	}
+}
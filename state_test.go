@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyCall(t *testing.T) {
+	state := &State{Salt: "salt", Targets: map[string]map[string]SecretState{}}
+	key := stateKeyForRepo("sharat87/prestige")
+	state.Set(key, "ONE", SecretState{ValueHmac: state.Hmac("one"), UpdatedAt: "2022-06-01T00:00:00Z"})
+
+	existing := map[string]string{"ONE": "2022-06-01T00:00:00Z", "TWO": "2022-06-01T00:00:00Z"}
+
+	call, warnings := classifyCall(state, key, "ONE", state.Hmac("one"), existing)
+	assert.Equal(t, "unchanged", call)
+	assert.Empty(t, warnings)
+
+	call, warnings = classifyCall(state, key, "ONE", state.Hmac("changed"), existing)
+	assert.Equal(t, "update", call)
+	assert.Empty(t, warnings)
+
+	call, warnings = classifyCall(state, key, "ONE", state.Hmac("one"), map[string]string{"ONE": "2022-06-02T00:00:00Z"})
+	assert.Equal(t, "update", call)
+	assert.Len(t, warnings, 1)
+
+	call, _ = classifyCall(state, key, "TWO", state.Hmac("two"), existing)
+	assert.Equal(t, "update", call)
+
+	call, _ = classifyCall(state, key, "THREE", state.Hmac("three"), existing)
+	assert.Equal(t, "create", call)
+
+	call, _ = classifyCall(nil, key, "ONE", "", existing)
+	assert.Equal(t, "update", call)
+}
+
+func TestStateSaveAndLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := loadState(filename)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, state.Salt)
+
+	state.Set(stateKeyForOrg("acme"), "ONE", SecretState{ValueHmac: state.Hmac("one"), UpdatedAt: "now"})
+	assert.NoError(t, state.Save(filename))
+
+	loaded, err := loadState(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+	assert.Equal(t, state.Hmac("one"), loaded.Hmac("one"))
+	assert.NotEqual(t, state.Hmac("one"), loaded.Hmac("two"))
+
+	loaded.Delete(stateKeyForOrg("acme"), "ONE")
+	assert.Empty(t, loaded.Targets)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sharat87/gass/github"
+	"strings"
+)
+
+// Used secrets found so far in a run, by where they were found, so that a repo's workflows are only looked into once,
+// even when they are needed both for the repo, and for an org whose secrets the repo can see. The maps in it are shared,
+// and must not be changed.
+type UsageCache map[string]map[string][]github.SecretUsage
+
+func (c UsageCache) get(key string, fetch func() (map[string][]github.SecretUsage, error)) (map[string][]github.SecretUsage, error) {
+	if usedSecrets, ok := c[key]; ok {
+		return usedSecrets, nil
+	}
+
+	usedSecrets, err := fetch()
+	if err == nil && c != nil {
+		c[key] = usedSecrets
+	}
+	return usedSecrets, err
+}
+
+// Find the secrets used by a repo's workflows, from a local checkout, if one is given, or from GitHub.
+func fetchUsedSecrets(repoName string, repo SyncSpecRepo, opts ComputeOptions) (map[string][]github.SecretUsage, error) {
+	dir := opts.WorkflowsFrom
+	if dir == "" {
+		dir = repo.LocalPath
+	}
+
+	if dir != "" {
+		return opts.UsageCache.get("dir:"+dir, func() (map[string][]github.SecretUsage, error) {
+			return github.ReadUsedSecrets(dir)
+		})
+	}
+
+	return opts.UsageCache.get("repo:"+repoName+"@"+opts.WorkflowsRef, func() (map[string][]github.SecretUsage, error) {
+		return github.FetchUsedSecrets(repoName, opts.WorkflowsRef)
+	})
+}
+
+// Find the secrets used by a repo that can see an org's secrets. Its workflows are looked into as they are on GitHub,
+// on its default branch, since a checkout given with `--workflows-from`, or a ref given with `--workflows-ref`, is meant
+// for a single repo.
+func fetchOrgRepoUsedSecrets(repoName string, opts ComputeOptions) (map[string][]github.SecretUsage, error) {
+	opts.WorkflowsFrom = ""
+	opts.WorkflowsRef = ""
+	return fetchUsedSecrets(repoName, SyncSpecRepo{}, opts)
+}
+
+// Where an org's secret usage is found. These are GitHub's API, except in tests.
+type orgUsageSources struct {
+	Secrets       func(org string) ([]github.OrgSecret, error)
+	SelectedRepos func(org, secretName string) ([]github.Repo, error)
+	Repos         func(org string) ([]github.Repo, error)
+	UsedSecrets   func(repoName string) (map[string][]github.SecretUsage, error)
+}
+
+// Find where the org's secrets that are being deleted, or made visible to fewer repos, are used, by looking into the
+// workflows of every repo that can see them now. With `isAll`, all the org's secrets are looked into, like for an audit.
+// Usages have their repo set, so the plan shows which repos would break. Updates get a warning for each repo that uses
+// the secret, but won't be able to see it with the new visibility.
+func findOrgUsedSecrets(changes *QualifiedSecretCallsByOrg, isAll bool, sources orgUsageSources) error {
+	changes.UsedSecrets = map[string][]github.SecretUsage{}
+
+	names := map[string]bool{}
+	for _, call := range changes.Calls {
+		// Secrets made visible to all repos can't be lost by any repo, so there's no need to look for their usage.
+		if isAll || call.Call == "delete" || (call.Call == "update" && call.OrgVisibility != "" && call.OrgVisibility != "all") {
+			names[call.SecretName] = true
+		}
+	}
+	if isAll {
+		for _, name := range changes.UnmanagedSecrets {
+			names[name] = true
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	remoteSecrets, err := sources.Secrets(changes.OrgName)
+	if err != nil {
+		return err
+	}
+
+	orgRepos, err := sources.Repos(changes.OrgName)
+	if err != nil {
+		return err
+	}
+
+	reposByName := map[string]github.Repo{}
+	for _, repo := range orgRepos {
+		reposByName[repo.FullName] = repo
+	}
+
+	visibilities := map[string]string{}
+	for _, secret := range remoteSecrets {
+		visibilities[secret.Name] = secret.Visibility
+	}
+
+	callsByName := map[string]QualifiedSecretCall{}
+	for _, call := range changes.Calls {
+		callsByName[call.SecretName] = call
+	}
+
+	for _, name := range sortedKeys(names) {
+		visibility, isRemote := visibilities[name]
+
+		var selectedIds []int
+		if !isRemote {
+			// Secrets yet to be created are looked for in the repos that will be able to see them.
+			call, ok := callsByName[name]
+			if !ok || call.Call == "delete" {
+				continue
+			}
+			visibility, selectedIds = call.OrgVisibility, call.OrgRepoIds
+
+		} else if visibility == "selected" {
+			selectedRepos, err := sources.SelectedRepos(changes.OrgName, name)
+			if err != nil {
+				return err
+			}
+			for _, repo := range selectedRepos {
+				selectedIds = append(selectedIds, repo.Id)
+			}
+		}
+
+		for _, repo := range orgRepos {
+			if repo.Archived || !canSeeOrgSecret(repo, visibility, selectedIds) {
+				continue
+			}
+
+			usedSecrets, err := sources.UsedSecrets(repo.FullName)
+			if err != nil {
+				return fmt.Errorf("Error getting used secrets for repo '%v': %v", repo.FullName, err)
+			}
+
+			for _, usage := range usagesOf(usedSecrets, name) {
+				usage.Repo = repo.FullName
+				changes.UsedSecrets[name] = append(changes.UsedSecrets[name], usage)
+			}
+		}
+	}
+
+	for i, call := range changes.Calls {
+		if call.Call != "update" {
+			continue
+		}
+
+		warned := map[string]bool{}
+		for _, usage := range changes.UsedSecrets[call.SecretName] {
+			if warned[usage.Repo] || canSeeOrgSecret(reposByName[usage.Repo], call.OrgVisibility, call.OrgRepoIds) {
+				continue
+			}
+			warned[usage.Repo] = true
+			changes.Calls[i].Warnings = append(changes.Calls[i].Warnings, fmt.Sprintf(
+				"Used in repo '%v', which can't see it with visibility '%v'", usage.Repo, call.OrgVisibility))
+		}
+	}
+
+	return nil
+}
+
+// The usages of a secret, by any case of its name, since secret names are case insensitive.
+func usagesOf(usedSecrets map[string][]github.SecretUsage, secretName string) []github.SecretUsage {
+	usages := []github.SecretUsage{}
+	for _, name := range sortedKeys(usedSecrets) {
+		if strings.EqualFold(name, secretName) {
+			usages = append(usages, usedSecrets[name]...)
+		}
+	}
+	return usages
+}
+
+// Names of secrets that are kept, but aren't used by any workflow that can see them. These are the secrets in the calls,
+// other than deletions, and the unmanaged secrets, that are on GitHub but not in the config.
+func unusedSecrets(calls []QualifiedSecretCall, unmanaged []string, usedSecrets map[string][]github.SecretUsage) []string {
+	unused := []string{}
+	for _, name := range append(sortedKeys(specifiedNames(calls)), unmanaged...) {
+		if len(usagesOf(usedSecrets, name)) == 0 {
+			unused = append(unused, name)
+		}
+	}
+	return unused
+}
+
+// If a repo can see an org secret with the given visibility. An empty visibility is taken to be all.
+func canSeeOrgSecret(repo github.Repo, visibility string, selectedIds []int) bool {
+	switch visibility {
+	case "private":
+		return repo.Private
+	case "selected":
+		for _, id := range selectedIds {
+			if id == repo.Id {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// The usages by jobs that run in the given env. Usages by jobs whose env is only known when the workflow runs are
+// included as well, since the secret could come from this env then.
+func usagesInEnv(usedSecrets map[string][]github.SecretUsage, envName string) map[string][]github.SecretUsage {
+	inEnv := map[string][]github.SecretUsage{}
+	for name, usages := range usedSecrets {
+		for _, usage := range usages {
+			if usage.IsInEnvironment(envName) || usage.IsDynamicEnvironment() {
+				inEnv[name] = append(inEnv[name], usage)
+			}
+		}
+	}
+	return inEnv
+}
+
+// The usages of secrets that won't resolve when the workflows run, once the plan is applied, given the secrets at each
+// level. For a repo, that's usages by jobs outside of the envs managed by gass, since usages in those are checked for
+// the env instead. For an env, it's usages by jobs in exactly that env. Usages of built-in secrets are never missing.
+func missingCandidates(repo QualifiedSecretCallsByRepo, envName string, levels secretLevels) map[string][]github.SecretUsage {
+	candidates := map[string][]github.SecretUsage{}
+
+	// When repo secrets are filtered out, we don't know which are specified, so nothing can be said to be missing.
+	if repo.SkippedRepoSecrets {
+		return candidates
+	}
+
+	for name, usages := range repo.UsedSecrets {
+		if github.IsBuiltInSecret(name) {
+			continue
+		}
+		for _, usage := range usages {
+			if envName == "" && !isManagedEnv(repo, usage) && !levels.resolves(name, usage) {
+				candidates[name] = append(candidates[name], usage)
+			} else if envName != "" && usage.IsInEnvironment(envName) && levels.source(name, envName) == "" {
+				candidates[name] = append(candidates[name], usage)
+			}
+		}
+	}
+
+	return candidates
+}
+
+// The secrets, on GitHub, of envs that aren't in the config, but that jobs using secrets run in, so those usages can be
+// checked for secrets that won't resolve. When a job's env is only known at runtime, every env is looked into. Envs that
+// don't exist yet, which GitHub creates without any secrets when a job first runs in them, are left out.
+func fetchOtherEnvSecrets(repo QualifiedSecretCallsByRepo, envNames func(repoName string) ([]string, error), envSecrets func(repoName, envName string) (map[string]string, error)) (map[string][]string, error) {
+	// Usages outside of the envs in the config are only checked at the repo level, which is skipped along with its secrets.
+	if repo.SkippedRepoSecrets {
+		return nil, nil
+	}
+
+	isAll := false
+	wanted := map[string]bool{}
+	for name, usages := range repo.UsedSecrets {
+		if github.IsBuiltInSecret(name) {
+			continue
+		}
+		for _, usage := range usages {
+			if usage.IsDynamicEnvironment() {
+				isAll = true
+			} else if usage.Environment != "" && !isManagedEnv(repo, usage) {
+				wanted[strings.ToLower(usage.Environment)] = true
+			}
+		}
+	}
+
+	if !isAll && len(wanted) == 0 {
+		return nil, nil
+	}
+
+	existing, err := envNames(repo.FullRepoName)
+	if err != nil {
+		return nil, err
+	}
+
+	secretsByEnv := map[string][]string{}
+	for _, envName := range existing {
+		if isManagedEnv(repo, github.SecretUsage{Environment: envName}) || !(isAll || wanted[strings.ToLower(envName)]) {
+			continue
+		}
+
+		secrets, err := envSecrets(repo.FullRepoName, envName)
+		if err != nil {
+			return nil, fmt.Errorf("env '%v': %w", envName, err)
+		}
+		secretsByEnv[envName] = sortedKeys(secrets)
+	}
+
+	return secretsByEnv, nil
+}
+
+// Warnings for repo secrets used by jobs in envs managed by gass, that don't have the secret, so they fall back to the
+// repo's. That's often a secret meant for an env, that was set on the repo by mistake.
+func repoFallbackWarnings(repo QualifiedSecretCallsByRepo, secretName string) []string {
+	warnings := []string{}
+
+	for _, envName := range sortedKeys(repo.Envs) {
+		if specifiedNames(repo.Envs[envName].Calls)[secretName] {
+			continue
+		}
+		for _, usage := range repo.UsedSecrets[secretName] {
+			if usage.IsInEnvironment(envName) {
+				warnings = append(warnings, "Used by jobs in env '"+envName+"', but only defined at repo level")
+				break
+			}
+		}
+	}
+
+	return warnings
+}
+
+func isManagedEnv(repo QualifiedSecretCallsByRepo, usage github.SecretUsage) bool {
+	for envName := range repo.Envs {
+		if usage.IsInEnvironment(envName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Names of secrets that will exist after the calls are applied.
+func specifiedNames(calls []QualifiedSecretCall) map[string]bool {
+	names := map[string]bool{}
+	for _, call := range calls {
+		if call.Call != "delete" {
+			names[call.SecretName] = true
+		}
+	}
+	return names
+}
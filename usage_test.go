@@ -0,0 +1,202 @@
+package main
+
+import (
+	"github.com/sharat87/gass/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testOrgUsageSources(fetched *[]string) orgUsageSources {
+	return orgUsageSources{
+		Secrets: func(org string) ([]github.OrgSecret, error) {
+			return []github.OrgSecret{
+				{Name: "NPM_TOKEN", Visibility: "all"},
+				{Name: "DEPLOY_KEY", Visibility: "selected"},
+				{Name: "SENTRY_DSN", Visibility: "private"},
+			}, nil
+		},
+		SelectedRepos: func(org, secretName string) ([]github.Repo, error) {
+			return []github.Repo{{Id: 2, FullName: "acme/web"}}, nil
+		},
+		Repos: func(org string) ([]github.Repo, error) {
+			return []github.Repo{
+				{Id: 1, FullName: "acme/api", Private: true},
+				{Id: 2, FullName: "acme/web"},
+				{Id: 3, FullName: "acme/old", Private: true, Archived: true},
+			}, nil
+		},
+		UsedSecrets: func(repoName string) (map[string][]github.SecretUsage, error) {
+			*fetched = append(*fetched, repoName)
+			usage := github.SecretUsage{File: "ci.yml", Job: "build", Line: 7}
+			return map[string][]github.SecretUsage{
+				"NPM_TOKEN":  {usage},
+				"DEPLOY_KEY": {usage},
+				"SENTRY_DSN": {usage},
+			}, nil
+		},
+	}
+}
+
+func TestFindOrgUsedSecretsForDeletion(t *testing.T) {
+	changes := &QualifiedSecretCallsByOrg{OrgName: "acme", Calls: []QualifiedSecretCall{
+		{Call: "delete", SecretName: "NPM_TOKEN"},
+		{Call: "delete", SecretName: "DEPLOY_KEY"},
+		{Call: "delete", SecretName: "SENTRY_DSN"},
+	}}
+
+	fetched := []string{}
+	assert.NoError(t, findOrgUsedSecrets(changes, false, testOrgUsageSources(&fetched)))
+
+	assert.Equal(t, []string{"acme/api: ci.yml:7 (job build)", "acme/web: ci.yml:7 (job build)"}, usageStrings(changes.UsedSecrets["NPM_TOKEN"]))
+	assert.Equal(t, []string{"acme/web: ci.yml:7 (job build)"}, usageStrings(changes.UsedSecrets["DEPLOY_KEY"]))
+	assert.Equal(t, []string{"acme/api: ci.yml:7 (job build)"}, usageStrings(changes.UsedSecrets["SENTRY_DSN"]))
+	assert.NotContains(t, fetched, "acme/old")
+}
+
+func TestFindOrgUsedSecretsForNarrowedVisibility(t *testing.T) {
+	changes := &QualifiedSecretCallsByOrg{OrgName: "acme", Calls: []QualifiedSecretCall{
+		{Call: "update", SecretName: "NPM_TOKEN", OrgVisibility: "selected", OrgRepoIds: []int{1}},
+		{Call: "update", SecretName: "SENTRY_DSN", OrgVisibility: "all"},
+		{Call: "unchanged", SecretName: "DEPLOY_KEY", OrgVisibility: "private"},
+	}}
+
+	fetched := []string{}
+	assert.NoError(t, findOrgUsedSecrets(changes, false, testOrgUsageSources(&fetched)))
+
+	assert.Equal(t, []string{"Used in repo 'acme/web', which can't see it with visibility 'selected'"}, changes.Calls[0].Warnings)
+	assert.Empty(t, changes.Calls[1].Warnings)
+	assert.Empty(t, changes.Calls[2].Warnings)
+	assert.NotContains(t, changes.UsedSecrets, "SENTRY_DSN")
+}
+
+func TestFindOrgUsedSecretsSkipsOrgsWithoutDeletions(t *testing.T) {
+	changes := &QualifiedSecretCallsByOrg{OrgName: "acme", Calls: []QualifiedSecretCall{
+		{Call: "create", SecretName: "NEW_TOKEN", OrgVisibility: "private"},
+	}}
+
+	// No sources are given, so looking for usage would panic.
+	assert.NoError(t, findOrgUsedSecrets(changes, false, orgUsageSources{}))
+	assert.Empty(t, changes.UsedSecrets)
+}
+
+func TestUsageCache(t *testing.T) {
+	cache := UsageCache{}
+	calls := 0
+	fetch := func() (map[string][]github.SecretUsage, error) {
+		calls++
+		return map[string][]github.SecretUsage{"ONE": {{File: "ci.yml", Line: 3}}}, nil
+	}
+
+	first, err := cache.get("repo:acme/api@", fetch)
+	assert.NoError(t, err)
+	second, err := cache.get("repo:acme/api@", fetch)
+	assert.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, calls)
+
+	// Without a cache, every call fetches.
+	_, err = UsageCache(nil).get("repo:acme/api@", fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestFindOrgUsedSecretsForAudit(t *testing.T) {
+	changes := &QualifiedSecretCallsByOrg{
+		OrgName: "acme",
+		Calls: []QualifiedSecretCall{
+			{Call: "unchanged", SecretName: "NPM_TOKEN"},
+			{Call: "create", SecretName: "DEPLOY_KEY", OrgVisibility: "selected", OrgRepoIds: []int{1}},
+		},
+		UnmanagedSecrets: []string{"SENTRY_DSN"},
+	}
+
+	fetched := []string{}
+	sources := testOrgUsageSources(&fetched)
+	remoteSecrets := sources.Secrets
+	sources.Secrets = func(org string) ([]github.OrgSecret, error) {
+		secrets, err := remoteSecrets(org)
+		return secrets[:1], err
+	}
+	assert.NoError(t, findOrgUsedSecrets(changes, true, sources))
+
+	assert.Equal(t, []string{"acme/api: ci.yml:7 (job build)", "acme/web: ci.yml:7 (job build)"}, usageStrings(changes.UsedSecrets["NPM_TOKEN"]))
+	// Secrets yet to be created are looked for in the repos that will see them.
+	assert.Equal(t, []string{"acme/api: ci.yml:7 (job build)"}, usageStrings(changes.UsedSecrets["DEPLOY_KEY"]))
+	// Unmanaged secrets that aren't on GitHub anymore can't be used by any repo.
+	assert.NotContains(t, changes.UsedSecrets, "SENTRY_DSN")
+}
+
+func TestUnusedSecrets(t *testing.T) {
+	calls := []QualifiedSecretCall{
+		{Call: "create", SecretName: "NPM_TOKEN"},
+		{Call: "update", SecretName: "DEPLOY_KEY"},
+		{Call: "delete", SecretName: "OLD_KEY"},
+	}
+	usedSecrets := map[string][]github.SecretUsage{
+		"npm_token": {{File: "ci.yml", Line: 4}},
+		"EMPTY":     {},
+	}
+
+	assert.Equal(t, []string{"DEPLOY_KEY", "EMPTY", "LEFTOVER"}, unusedSecrets(calls, []string{"EMPTY", "LEFTOVER"}, usedSecrets))
+}
+
+func TestFetchOrgRepoUsedSecretsIgnoresWorkflowsRef(t *testing.T) {
+	// The ref only exists in `acme/api`, the repo it was given for.
+	stubGitHub(t, map[string]string{
+		"repos/acme/api/contents/.github/workflows?ref=feature-x": `[]`,
+		"repos/acme/api/contents/.github/workflows":               `[]`,
+		"repos/acme/web/contents/.github/workflows":               `[]`,
+	})
+
+	opts := ComputeOptions{WorkflowsRef: "feature-x", WorkflowsFrom: "/src/api", UsageCache: UsageCache{}}
+
+	for _, repoName := range []string{"acme/api", "acme/web"} {
+		usedSecrets, err := fetchOrgRepoUsedSecrets(repoName, opts)
+		assert.NoError(t, err)
+		assert.Empty(t, usedSecrets)
+	}
+
+	_, err := fetchUsedSecrets("acme/web", SyncSpecRepo{}, ComputeOptions{WorkflowsRef: "feature-x"})
+	assert.Error(t, err)
+}
+
+func TestFetchOtherEnvSecrets(t *testing.T) {
+	repo := QualifiedSecretCallsByRepo{
+		FullRepoName: "acme/api",
+		UsedSecrets: map[string][]github.SecretUsage{
+			"DEPLOY_KEY":   {{File: "deploy.yml", Line: 9, Environment: "Staging"}},
+			"NPM_TOKEN":    {{File: "deploy.yml", Line: 10, Environment: "production"}},
+			"GITHUB_TOKEN": {{File: "deploy.yml", Line: 11, Environment: "preview"}},
+		},
+		Envs: map[string]QualifiedSecretCallsByRepoEnv{"production": {}},
+	}
+
+	fetched := []string{}
+	envNames := func(repoName string) ([]string, error) {
+		return []string{"production", "staging", "preview", "qa"}, nil
+	}
+	envSecrets := func(repoName, envName string) (map[string]string, error) {
+		fetched = append(fetched, envName)
+		return map[string]string{"DEPLOY_KEY": "2022-01-01T00:00:00Z"}, nil
+	}
+
+	// Only envs that aren't in the config, and that jobs using secrets, other than built-in ones, run in.
+	secrets, err := fetchOtherEnvSecrets(repo, envNames, envSecrets)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"staging": {"DEPLOY_KEY"}}, secrets)
+	assert.Equal(t, []string{"staging"}, fetched)
+
+	// With an env that's only known at runtime, all of them.
+	repo.UsedSecrets["SENTRY_DSN"] = []github.SecretUsage{{File: "release.yml", Line: 4, Environment: "${{ inputs.env }}"}}
+	secrets, err = fetchOtherEnvSecrets(repo, envNames, envSecrets)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"preview", "qa", "staging"}, sortedKeys(secrets))
+
+	// Without usages in other envs, nothing is fetched.
+	fetched = []string{}
+	secrets, err = fetchOtherEnvSecrets(QualifiedSecretCallsByRepo{FullRepoName: "acme/web"}, envNames, envSecrets)
+	assert.NoError(t, err)
+	assert.Nil(t, secrets)
+	assert.Empty(t, fetched)
+}
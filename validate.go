@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Check a config for problems that would otherwise only show up when syncing, without calling GitHub. Returns a
+// description of each problem found, sorted.
+func validateConfig(spec SyncSpec, packs map[string]SecretPack, now time.Time) []string {
+	problems := []string{}
+
+	checkSecrets := func(where string, usePacks []string, secrets map[string]SecretValueSpec, isOrg bool) {
+		resolved, _, err := resolveSecrets(packs, usePacks, secrets)
+		if err != nil {
+			problems = append(problems, where+": "+err.Error())
+			return
+		}
+
+		for name, valueSpec := range resolved {
+			for _, problem := range validateSecret(valueSpec, now, isOrg) {
+				problems = append(problems, where+" secret "+name+": "+problem)
+			}
+		}
+	}
+
+	checkEnvs := func(where string, envs map[string]SecretPack) {
+		for envName, env := range envs {
+			checkSecrets(where+" env "+envName, env.UsePacks, env.Secrets, false)
+		}
+	}
+
+	for repoName, repo := range spec.Repos {
+		where := "repo " + repoName
+		if parts := strings.Split(repoName, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			problems = append(problems, where+": Should be like `owner/name`")
+		}
+		checkSecrets(where, repo.UsePacks, repo.Secrets, false)
+		checkEnvs(where, repo.Envs)
+	}
+
+	for i, selector := range spec.RepoSelectors {
+		where := fmt.Sprintf("repo selector %v", i+1)
+		if selector.Org == "" {
+			problems = append(problems, where+": Missing `org`")
+		}
+		if _, err := path.Match(selector.NameGlob, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("%v: Invalid `name_glob` '%v': %v", where, selector.NameGlob, err))
+		}
+		if selector.LocalPath != "" {
+			problems = append(problems, where+": `local_path` can only be given for repos, not selectors")
+		}
+		checkSecrets(where, selector.UsePacks, selector.Secrets, false)
+		checkEnvs(where, selector.Envs)
+	}
+
+	for orgName, org := range spec.Orgs {
+		checkSecrets("org "+orgName, org.UsePacks, org.Secrets, true)
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+func validateSecret(spec SecretValueSpec, now time.Time, isOrg bool) []string {
+	problems := []string{}
+
+	if spec.Value != "" && spec.FromEnv != "" {
+		problems = append(problems, "Only one of `value` and `from_env` can be given")
+	}
+
+	// The expiry window doesn't matter here, since expiring soon is only a warning.
+	if _, err := checkExpiry(spec, now, 0); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if isOrg {
+		switch spec.OrgVisibility {
+		case "", "all", "private", "selected":
+		default:
+			problems = append(problems, fmt.Sprintf("Invalid `visibility` '%v', should be one of all, private or selected", spec.OrgVisibility))
+		}
+
+		if len(spec.OrgSelectedRepos) > 0 && spec.OrgVisibility != "selected" {
+			problems = append(problems, "`selected_repos` is only used when `visibility` is selected")
+		}
+
+	} else if spec.OrgVisibility != "" || len(spec.OrgSelectedRepos) > 0 {
+		problems = append(problems, "`visibility` and `selected_repos` only apply to org secrets")
+	}
+
+	return problems
+}
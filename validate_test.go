@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestValidateConfig(t *testing.T) {
+	spec, err := parseConfig([]byte(`
+repos:
+  sharat87/prestige:
+    use_packs: [missing-pack]
+  not-a-repo:
+    secrets:
+      BOTH:
+        value: one
+        from_env: ONE
+    envs:
+      production:
+        secrets:
+          OLD:
+            value: old
+            expires: 2022-01-01
+repo_selectors:
+  - name_glob: "svc-["
+orgs:
+  acme:
+    use_packs: [aws]
+    secrets:
+      PUBLIC:
+        value: one
+        visibility: public
+`), "yaml")
+	assert.NoError(t, err)
+
+	packs := map[string]SecretPack{
+		"aws": {Secrets: map[string]SecretValueSpec{
+			"AWS_KEY": {Value: "key", OrgVisibility: "private"},
+		}},
+	}
+
+	assert.Equal(t, []string{
+		"org acme secret PUBLIC: Invalid `visibility` 'public', should be one of all, private or selected",
+		"repo not-a-repo env production secret OLD: Expired on 2022-01-01",
+		"repo not-a-repo secret BOTH: Only one of `value` and `from_env` can be given",
+		"repo not-a-repo: Should be like `owner/name`",
+		"repo selector 1: Invalid `name_glob` 'svc-[': syntax error in pattern",
+		"repo selector 1: Missing `org`",
+		"repo sharat87/prestige: Unknown pack 'missing-pack' in `use_packs`",
+	}, validateConfig(spec, packs, time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestValidateConfigWithoutProblems(t *testing.T) {
+	spec, err := parseConfig([]byte(`
+repos:
+  sharat87/prestige:
+    secrets:
+      ONE:
+        value: one
+orgs:
+  acme:
+    secrets:
+      TWO:
+        value: two
+        visibility: selected
+        selected_repos: [prestige]
+`), "yaml")
+	assert.NoError(t, err)
+	assert.Empty(t, validateConfig(spec, nil, time.Now()))
+}
+
+func TestValidateConfigLocalPathInSelector(t *testing.T) {
+	spec, err := parseConfig([]byte(`
+repo_selectors:
+  - org: acme
+    local_path: ../checkout
+`), "yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"repo selector 1: `local_path` can only be given for repos, not selectors",
+	}, validateConfig(spec, nil, time.Now()))
+}